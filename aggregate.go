@@ -0,0 +1,235 @@
+package ok
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// aggregateFunction is a parsed AggregateFunction(f, T...) or SimpleAggregateFunction(f, T) column type.
+// The driver cannot write these columns, so fixtures carry the plain argument values
+// and the states are built on the server from a staging table.
+type aggregateFunction struct {
+	simple    bool
+	function  string
+	arguments []string
+}
+
+func parseAggregateFunction(t string) (*aggregateFunction, bool) {
+	var f aggregateFunction
+	switch {
+	case strings.HasPrefix(t, "AggregateFunction(") && strings.HasSuffix(t, ")"):
+		t = t[len("AggregateFunction(") : len(t)-1]
+	case strings.HasPrefix(t, "SimpleAggregateFunction(") && strings.HasSuffix(t, ")"):
+		f.simple, t = true, t[len("SimpleAggregateFunction("):len(t)-1]
+	default:
+		return nil, false
+	}
+	args := splitList(t)
+	if len(args) < 2 || (f.simple && len(args) != 2) {
+		return nil, false
+	}
+	f.function, f.arguments = args[0], args[1:]
+	return &f, true
+}
+
+// state returns the -State combinator of the function keeping its parameters, "quantiles(0.5)" becomes "quantilesState(0.5)".
+func (f *aggregateFunction) state() string {
+	if i := strings.Index(f.function, "("); i != -1 {
+		return f.function[:i] + "State" + f.function[i:]
+	}
+	return f.function + "State"
+}
+
+// staging returns the column types of the staging table and the expression
+// building the column value from the staging columns.
+func (f *aggregateFunction) staging(names []string) (types []string, expression string) {
+	if f.simple {
+		return f.arguments, names[0]
+	}
+	for _, argument := range f.arguments {
+		types = append(types, "Array("+argument+")")
+	}
+	return types, "arrayReduce(" + quote(f.state()) + ", " + strings.Join(names, ", ") + ")"
+}
+
+// converter converts the plain input of the column. A single argument function takes a value
+// or an array of values aggregated into one state, e.g. "[1,2,3]" for uniq. Functions with several
+// arguments take a tuple of values, e.g. "(10,'2019-02-09 10:10:10')" for argMax, or a tuple of
+// arrays of the same length, e.g. "([10,20],['2019-02-09 10:10:10','2019-02-10 10:10:10'])".
+func (f *aggregateFunction) converter(location *time.Location) (converter, error) {
+	converters := make([]converter, 0, len(f.arguments))
+	for _, argument := range f.arguments {
+		convert, err := converterFactory(argument, location)
+		if err != nil {
+			return nil, err
+		}
+		converters = append(converters, convert)
+	}
+	switch {
+	case f.simple:
+		return converters[0], nil
+	case len(converters) == 1:
+		many := f.many(0, converters[0])
+		return func(src string) (interface{}, error) {
+			if strings.HasPrefix(src, "[") && !strings.HasPrefix(f.arguments[0], "Array") {
+				return many(src)
+			}
+			return single(converters[0], src)
+		}, nil
+	}
+	return func(src string) (interface{}, error) {
+		if !strings.HasPrefix(src, "(") || !strings.HasSuffix(src, ")") {
+			return nil, fmt.Errorf("expected a tuple of %d values for %s, got '%s'", len(converters), f.function, src)
+		}
+		values := splitList(src[1 : len(src)-1])
+		if len(values) != len(converters) {
+			return nil, fmt.Errorf("expected a tuple of %d values for %s, got '%s'", len(converters), f.function, src)
+		}
+		result := make(multiValue, 0, len(values))
+		for i, value := range values {
+			if strings.HasPrefix(value, "[") && !strings.HasPrefix(f.arguments[i], "Array") {
+				v, err := f.many(i, converters[i])(value)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, v)
+				continue
+			}
+			if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = value[1 : len(value)-1]
+			}
+			v, err := single(converters[i], value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, v)
+		}
+		return result, nil
+	}, nil
+}
+
+// many converts an array of values of the argument.
+func (f *aggregateFunction) many(argument int, convert converter) converter {
+	sliceType, _ := columnGoType("Array(" + f.arguments[argument] + ")")
+	return arrayT(convert, sliceType)
+}
+
+// single converts the value into a slice holding just that value.
+func single(convert converter, src string) (interface{}, error) {
+	v, err := convert(src)
+	if err != nil {
+		return nil, err
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(v)), 0, 1)
+	return reflect.Append(slice, reflect.ValueOf(v)).Interface(), nil
+}
+
+func hasAggregateFunctions(types []string) bool {
+	for _, t := range types {
+		if _, ok := parseAggregateFunction(t); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stagingColumns returns the column definitions of the staging table and the expressions
+// computing the target columns from it.
+func stagingColumns(types []string) (definitions, expressions []string) {
+	for i, t := range types {
+		name := fmt.Sprintf("_%d", i)
+		f, ok := parseAggregateFunction(t)
+		if !ok {
+			definitions, expressions = append(definitions, name+" "+t), append(expressions, name)
+			continue
+		}
+		names := []string{name}
+		if !f.simple && len(f.arguments) > 1 {
+			names = names[:0]
+			for j := range f.arguments {
+				names = append(names, fmt.Sprintf("_%d_%d", i, j))
+			}
+		}
+		stagingTypes, expression := f.staging(names)
+		for j, name := range names {
+			definitions = append(definitions, name+" "+stagingTypes[j])
+		}
+		expressions = append(expressions, expression)
+	}
+	return definitions, expressions
+}
+
+// copyThroughStaging inserts the rows into a Memory staging table
+// and builds the aggregate function states while copying them to the table.
+func (c *clickhouse) copyThroughStaging(database, table string, columns, types []string, rows [][]interface{}) error {
+	if len(columns) == 0 {
+		var err error
+		if columns, err = c.columnNames(database, table); err != nil {
+			return err
+		}
+	}
+	var (
+		staging                  = fmt.Sprintf("%s._ok_staging_%d", database, time.Now().UnixNano())
+		definitions, expressions = stagingColumns(types)
+		quoted                   = make([]string, 0, len(columns))
+	)
+	for _, column := range columns {
+		quoted = append(quoted, quoteIdentifier(column))
+	}
+	if _, err := c.conn.Exec("CREATE TABLE " + staging + " (" + strings.Join(definitions, ", ") + ") Engine Memory"); err != nil {
+		return fmt.Errorf("could not create staging table: %v", err)
+	}
+	defer c.conn.Exec("DROP TABLE IF EXISTS " + staging)
+	if err := c.insert("INSERT INTO "+staging+" VALUES", rows); err != nil {
+		return err
+	}
+	_, err := c.conn.Exec(fmt.Sprintf("INSERT INTO %s.%s (%s) SELECT %s FROM %s",
+		database, table, strings.Join(quoted, ", "), strings.Join(expressions, ", "), staging,
+	))
+	return err
+}
+
+// columnNames returns the columns an INSERT without a column list expects, MATERIALIZED and ALIAS columns left out.
+func (c *clickhouse) columnNames(database, table string) (names []string, _ error) {
+	rows, err := c.conn.Query("SELECT name FROM system.columns WHERE database = ? AND table = ? AND default_kind NOT IN ('MATERIALIZED', 'ALIAS')", database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// splitList splits a comma separated list at the top level, keeping
+// parenthesized, bracketed and quoted parts together.
+func splitList(src string) (parts []string) {
+	var (
+		depth  int
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(src); i++ {
+		switch ch := src[i]; {
+		case quoted && ch == '\\':
+			i++
+		case ch == '\'':
+			quoted = !quoted
+		case quoted:
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case ch == ',' && depth == 0:
+			parts, start = append(parts, strings.TrimSpace(src[start:i])), i+1
+		}
+	}
+	return append(parts, strings.TrimSpace(src[start:]))
+}
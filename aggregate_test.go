@@ -0,0 +1,127 @@
+package ok
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAggregateFunction(t *testing.T) {
+	assets := map[string]*aggregateFunction{
+		"AggregateFunction(uniq, UInt64)":                         {function: "uniq", arguments: []string{"UInt64"}},
+		"AggregateFunction(argMax, String, DateTime)":             {function: "argMax", arguments: []string{"String", "DateTime"}},
+		"AggregateFunction(quantiles(0.5, 0.9), Float64)":         {function: "quantiles(0.5, 0.9)", arguments: []string{"Float64"}},
+		"SimpleAggregateFunction(max, UInt32)":                    {simple: true, function: "max", arguments: []string{"UInt32"}},
+		"SimpleAggregateFunction(groupArrayArray, Array(String))": {simple: true, function: "groupArrayArray", arguments: []string{"Array(String)"}},
+	}
+	for src, expected := range assets {
+		if f, ok := parseAggregateFunction(src); assert.True(t, ok, src) {
+			assert.Equal(t, expected, f)
+		}
+	}
+	for _, src := range []string{"UInt64", "AggregateFunction(uniq)", "SimpleAggregateFunction(argMax, String, DateTime)"} {
+		_, ok := parseAggregateFunction(src)
+		assert.False(t, ok, src)
+	}
+	assert.Equal(t, "quantilesState(0.5, 0.9)", (&aggregateFunction{function: "quantiles(0.5, 0.9)"}).state())
+	assert.Equal(t, "uniqState", (&aggregateFunction{function: "uniq"}).state())
+}
+
+func TestStagingColumns(t *testing.T) {
+	definitions, expressions := stagingColumns([]string{
+		"Date",
+		"AggregateFunction(uniq, UInt64)",
+		"SimpleAggregateFunction(sum, UInt64)",
+		"AggregateFunction(argMax, UInt64, DateTime)",
+	})
+	assert.Equal(t, []string{
+		"_0 Date",
+		"_1 Array(UInt64)",
+		"_2 UInt64",
+		"_3_0 Array(UInt64)",
+		"_3_1 Array(DateTime)",
+	}, definitions)
+	assert.Equal(t, []string{
+		"_0",
+		"arrayReduce('uniqState', _1)",
+		"_2",
+		"arrayReduce('argMaxState', _3_0, _3_1)",
+	}, expressions)
+}
+
+func TestAggregateFunctionConverter(t *testing.T) {
+	assets := []struct {
+		chType   string
+		src      string
+		expected interface{}
+	}{
+		{chType: "AggregateFunction(uniq, UInt64)", src: "42", expected: []uint64{42}},
+		{chType: "AggregateFunction(uniq, UInt64)", src: "[1,2,3]", expected: []uint64{1, 2, 3}},
+		{chType: "AggregateFunction(groupUniqArray, String)", src: "a", expected: []string{"a"}},
+		{chType: "AggregateFunction(groupArrayArray, Array(UInt8))", src: "[1,2]", expected: [][]uint8{{1, 2}}},
+		{chType: "SimpleAggregateFunction(sum, UInt64)", src: "42", expected: uint64(42)},
+		{chType: "AggregateFunction(argMax, String, UInt32)", src: "('a,b', 10)", expected: multiValue{[]string{"a,b"}, []uint32{10}}},
+		{chType: "AggregateFunction(argMax, String, UInt32)", src: "(['a','it\\'s'],[10,20])", expected: multiValue{[]string{"a", "it's"}, []uint32{10, 20}}},
+		{chType: "AggregateFunction(argMax, String, UInt32)", src: "([],[])", expected: multiValue{[]string{}, []uint32{}}},
+		{chType: "AggregateFunction(uniq, UInt64)", src: "[]", expected: []uint64{}},
+	}
+	for _, asset := range assets {
+		if converter, err := converterFactory(asset.chType, time.UTC); assert.NoError(t, err) {
+			if value, err := converter(asset.src); assert.NoError(t, err) {
+				assert.Equal(t, asset.expected, value, asset.chType)
+			}
+		}
+	}
+	if converter, err := converterFactory("AggregateFunction(argMax, String, UInt32)", time.UTC); assert.NoError(t, err) {
+		_, err := converter("a")
+		assert.Error(t, err)
+	}
+	if rows, err := csvToArgs([]string{"UInt8", "AggregateFunction(argMax, String, UInt32)"}, strings.NewReader("1,\"(x,2)\"\n"), ',', time.UTC); assert.NoError(t, err) {
+		assert.Equal(t, [][]interface{}{{uint8(1), []string{"x"}, []uint32{2}}}, rows)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	assets := map[string][]string{
+		"a, b":                       {"a", "b"},
+		"quantiles(0.5, 0.9), UInt8": {"quantiles(0.5, 0.9)", "UInt8"},
+		"'a,b', [1,2], (3, 4)":       {"'a,b'", "[1,2]", "(3, 4)"},
+		`'it\'s, ok', 1`:             {`'it\'s, ok'`, "1"},
+	}
+	for src, expected := range assets {
+		assert.Equal(t, expected, splitList(src))
+	}
+}
+
+func TestAggregateFunctionFixtures(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.SetWaitTimeout(10 * time.Second)
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE aggregate_tester;
+	CREATE TABLE aggregate_tester.rollup (
+		day       Date
+		, users   AggregateFunction(uniq, UInt64)
+		, hits    SimpleAggregateFunction(sum, UInt64)
+		, last    AggregateFunction(argMax, UInt64, DateTime)
+		, value   UInt64
+	) Engine AggregatingMergeTree ORDER BY day;
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	if assert.True(t, clickhouse.CopyFromCSVFile("testdata/aggregate/rollup.csv", "INSERT INTO aggregate_tester.rollup VALUES")) {
+		assert.True(t, clickhouse.AssertPipeline(Pipeline{
+			Source: "INSERT INTO aggregate_tester.rollup (day, users, hits, last, value)",
+			Rows:   "2019-02-10,5,1,\"(40,'2019-02-10 09:00:00')\",0\n",
+			Targets: []PipelineTarget{
+				{
+					Query:    "SELECT day, uniqMerge(users), sum(hits), argMaxMerge(last) FROM aggregate_tester.rollup GROUP BY day ORDER BY day",
+					Expected: "2019-02-09\t3\t3\t10\n2019-02-10\t2\t4\t30\n",
+				},
+			},
+		}))
+	}
+}
@@ -0,0 +1,174 @@
+package ok
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Baseline tracks the performance of named queries, run on fixtures loaded beforehand, in a JSON
+// file such as testdata/baseline.json, found via the search path. Each query runs Runs times (3 by default) and the medians of
+// its metrics from system.query_log are compared with the file. A metric regresses when it grows
+// by more than its tolerance, Tolerances by metric name ("read_rows", "read_bytes", "memory_usage",
+// "duration_ms") override Tolerance (0.1 by default). Run tests with -ok.update to refresh the file.
+type Baseline struct {
+	File       string
+	Queries    map[string]string
+	Runs       int
+	Tolerance  float64
+	Tolerances map[string]float64
+}
+
+// BaselineMetrics are the medians of the metrics of the runs of a query.
+type BaselineMetrics struct {
+	ReadRows    uint64 `json:"read_rows"`
+	ReadBytes   uint64 `json:"read_bytes"`
+	MemoryUsage uint64 `json:"memory_usage"`
+	DurationMs  uint64 `json:"duration_ms"`
+}
+
+// AssertBaseline runs the queries of the baseline and checks that their metrics did not regress.
+func (c *clickhouse) AssertBaseline(baseline Baseline) bool {
+	var (
+		names    = make([]string, 0, len(baseline.Queries))
+		measured = make(map[string]BaselineMetrics, len(baseline.Queries))
+		runs     = baseline.Runs
+	)
+	for name := range baseline.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if runs <= 0 {
+		runs = 3
+	}
+	for _, name := range names {
+		metrics, err := c.benchmark(baseline.Queries[name], runs)
+		if err != nil {
+			c.test.Errorf("query '%s': an error occurred while running the query: %v", name, err)
+			return false
+		}
+		measured[name] = metrics
+	}
+	path := c.goldenPath(baseline.File)
+	expected, err := readBaselines(path)
+	if *update {
+		if expected == nil {
+			expected = make(map[string]BaselineMetrics, len(measured))
+		}
+		for name, metrics := range measured {
+			expected[name] = metrics
+		}
+		data, err := json.MarshalIndent(expected, "", "  ")
+		if err == nil {
+			err = writeGolden(path, string(data)+"\n")
+		}
+		if err != nil {
+			c.test.Errorf("could not update baseline file: %v", err)
+			return false
+		}
+		return true
+	}
+	if err != nil {
+		c.test.Errorf("could not read baseline file (run with -ok.update to create it): %v", err)
+		return false
+	}
+	ok := true
+	for _, name := range names {
+		metrics, found := expected[name]
+		if !found {
+			c.test.Errorf("query '%s' has no baseline in '%s' (run with -ok.update to add it)", name, baseline.File)
+			ok = false
+			continue
+		}
+		if regressions := baseline.regressions(metrics, measured[name]); len(regressions) != 0 {
+			c.test.Errorf("query '%s' regressed:\n%s", name, strings.Join(regressions, "\n"))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// regressions describes the metrics that grew beyond their tolerance. Durations are logged
+// in milliseconds, they may grow by one more millisecond. The memory usage of small queries
+// varies with the allocations of the server, it may grow by memoryResolution more.
+func (baseline Baseline) regressions(expected, actual BaselineMetrics) []string {
+	var regressions []string
+	for _, metric := range []struct {
+		name             string
+		expected, actual uint64
+		resolution       float64
+	}{
+		{"read_rows", expected.ReadRows, actual.ReadRows, 0},
+		{"read_bytes", expected.ReadBytes, actual.ReadBytes, 0},
+		{"memory_usage", expected.MemoryUsage, actual.MemoryUsage, memoryResolution},
+		{"duration_ms", expected.DurationMs, actual.DurationMs, 1},
+	} {
+		tolerance := baseline.tolerance(metric.name)
+		if float64(metric.actual) > float64(metric.expected)*(1+tolerance)+metric.resolution {
+			regressions = append(regressions, fmt.Sprintf("%s: %d -> %d (tolerance %g%%)",
+				metric.name, metric.expected, metric.actual, tolerance*100,
+			))
+		}
+	}
+	return regressions
+}
+
+const memoryResolution = 4 << 20
+
+func (baseline Baseline) tolerance(metric string) float64 {
+	if tolerance, found := baseline.Tolerances[metric]; found {
+		return tolerance
+	}
+	if baseline.Tolerance != 0 {
+		return baseline.Tolerance
+	}
+	return 0.1
+}
+
+// benchmark runs the query and returns the medians of its metrics.
+func (c *clickhouse) benchmark(query string, runs int) (BaselineMetrics, error) {
+	var readRows, readBytes, memoryUsage, duration []uint64
+	for i := 0; i < runs; i++ {
+		entry, err := c.measure(query)
+		if err != nil {
+			return BaselineMetrics{}, err
+		}
+		readRows = append(readRows, entry.ReadRows)
+		readBytes = append(readBytes, entry.ReadBytes)
+		memoryUsage = append(memoryUsage, entry.MemoryUsage)
+		duration = append(duration, uint64(entry.Duration.Nanoseconds()/1e6))
+	}
+	return BaselineMetrics{
+		ReadRows:    median(readRows),
+		ReadBytes:   median(readBytes),
+		MemoryUsage: median(memoryUsage),
+		DurationMs:  median(duration),
+	}, nil
+}
+
+func median(values []uint64) uint64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]uint64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[len(sorted)/2]
+}
+
+// readBaselines reads the metrics by query name from the baseline file.
+func readBaselines(path string) (map[string]BaselineMetrics, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var baselines map[string]BaselineMetrics
+	if err := json.NewDecoder(file).Decode(&baselines); err != nil {
+		return nil, fmt.Errorf("could not parse '%s': %v", path, err)
+	}
+	return baselines, nil
+}
@@ -0,0 +1,76 @@
+package ok
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, uint64(0), median(nil))
+	assert.Equal(t, uint64(5), median([]uint64{9, 1, 5}))
+	assert.Equal(t, uint64(7), median([]uint64{7, 1, 9, 5}))
+}
+
+func TestBaselineRegressions(t *testing.T) {
+	var (
+		baseline = Baseline{
+			Tolerances: map[string]float64{"duration_ms": 1},
+		}
+		expected = BaselineMetrics{ReadRows: 1000, ReadBytes: 8000, MemoryUsage: 1 << 20, DurationMs: 10}
+	)
+	assert.Empty(t, baseline.regressions(expected, BaselineMetrics{ReadRows: 1100, ReadBytes: 4000, MemoryUsage: 1 << 20, DurationMs: 21}))
+	assert.Equal(t, []string{
+		"read_rows: 1000 -> 1101 (tolerance 10%)",
+		"duration_ms: 10 -> 22 (tolerance 100%)",
+	}, baseline.regressions(expected, BaselineMetrics{ReadRows: 1101, ReadBytes: 8000, MemoryUsage: 1 << 20, DurationMs: 22}))
+	assert.Empty(t, baseline.regressions(expected, BaselineMetrics{ReadRows: 1000, ReadBytes: 8000, MemoryUsage: 3 << 20, DurationMs: 10}))
+	assert.Equal(t, []string{
+		"memory_usage: 1048576 -> 6291456 (tolerance 10%)",
+	}, baseline.regressions(expected, BaselineMetrics{ReadRows: 1000, ReadBytes: 8000, MemoryUsage: 6 << 20, DurationMs: 10}))
+	assert.Equal(t, []string{
+		"read_bytes: 0 -> 1 (tolerance 10%)",
+	}, baseline.regressions(BaselineMetrics{}, BaselineMetrics{ReadBytes: 1, DurationMs: 1}))
+}
+
+func TestBaseline(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	clickhouse.RequireSetting("log_comment")
+	dir, err := ioutil.TempDir("", "ok")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ddl := `
+		CREATE DATABASE baseline_tester;
+		CREATE TABLE baseline_tester.events (
+			id    UInt64,
+			value Float64
+		) Engine MergeTree ORDER BY id;
+		INSERT INTO baseline_tester.events SELECT number, number / 2 FROM system.numbers LIMIT 10000;
+	`
+	if !assert.NoError(t, clickhouse.Exec(ddl)) {
+		return
+	}
+	baseline := Baseline{
+		File: "baseline.json",
+		Queries: map[string]string{
+			"total": "SELECT sum(value) FROM baseline_tester.events",
+			"point": "SELECT value FROM baseline_tester.events WHERE id = 42",
+		},
+		Tolerances: map[string]float64{"duration_ms": 10},
+	}
+	clickhouse.SetSearchPath(dir)
+	defer func(value bool) {
+		*update = value
+	}(*update)
+	*update = true
+	assert.True(t, clickhouse.AssertBaseline(baseline))
+	assert.FileExists(t, filepath.Join(dir, "baseline.json"))
+	*update = false
+	assert.True(t, clickhouse.AssertBaseline(baseline))
+}
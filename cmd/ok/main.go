@@ -0,0 +1,262 @@
+// Command ok applies schemas, loads fixtures, runs .sql/.reference functional tests
+// and dumps schema snapshots with the ok package, without writing Go tests.
+//
+//	ok -dsn tcp://127.0.0.1:9000 apply schema.sql
+//	ok load db.events events.csv events.json
+//	ok test tests/
+//	ok snapshot db testdata/db.sql
+//	ok clean
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/ClickHouse-Ninja/ok"
+	_ "github.com/kshvakov/clickhouse"
+)
+
+const usage = `usage: ok [flags] command [arguments]
+
+commands:
+  apply file...                  execute the schema files
+  load table file...             load CSV, TSV or JSONEachRow (.json, .jsonl) fixtures into the table
+  test dir...                    run the NNNNN_name.sql/.reference functional tests of the directories
+  snapshot database [golden]     print the schema snapshot of the database or compare it with the golden file
+  clean                          drop the objects created by apply
+
+flags:
+`
+
+var (
+	dsn    = flag.String("dsn", "tcp://127.0.0.1:9000", "ClickHouse DSN")
+	state  = flag.String("state", ".ok-state.json", "file keeping the objects created by apply for clean")
+	update = flag.Bool("update", false, "update reference and golden files instead of comparing with them")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *update {
+		flag.Set("ok.update", "true")
+	}
+	command, found := commands[flag.Arg(0)]
+	if !found {
+		fmt.Fprintf(os.Stderr, "ok: unknown command '%s'\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	r := &reporter{name: flag.Arg(0), out: os.Stderr}
+	if !run(r, func() { command(r, flag.Args()[1:]) }) || r.Failed() {
+		os.Exit(1)
+	}
+}
+
+var commands = map[string]func(r *reporter, args []string){
+	"apply":    apply,
+	"load":     load,
+	"test":     test,
+	"snapshot": snapshot,
+	"clean":    clean,
+}
+
+// run calls fn in its own goroutine, so Fatal and Skip can stop it the way they stop a test.
+// It reports whether fn returned normally.
+func run(r *reporter, fn func()) bool {
+	done := make(chan bool)
+	go func() {
+		completed := false
+		defer func() {
+			done <- completed
+		}()
+		fn()
+		completed = true
+	}()
+	return <-done || r.skipped
+}
+
+func apply(r *reporter, files []string) {
+	if len(files) == 0 {
+		r.Fatal("apply: no schema files")
+	}
+	clickhouse := ok.Connect(r, *dsn)
+	defer saveState(r, clickhouse)
+	for _, file := range files {
+		if err := clickhouse.ExecFromFile(file); err != nil {
+			r.Errorf("%s: %v", file, err)
+			return
+		}
+		r.Logf("applied %s", file)
+	}
+}
+
+func load(r *reporter, args []string) {
+	if len(args) < 2 {
+		r.Fatal("load: expected a table and fixture files")
+	}
+	var (
+		clickhouse = ok.Connect(r, *dsn)
+		query      = "INSERT INTO " + args[0] + " VALUES"
+	)
+	for _, file := range args[1:] {
+		var loaded bool
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".tsv", ".tab":
+			loaded = clickhouse.CopyFromTSVFile(file, query)
+		case ".json", ".jsonl", ".ndjson":
+			loaded = clickhouse.CopyFromJSONFile(file, query)
+		default:
+			loaded = clickhouse.CopyFromCSVFile(file, query)
+		}
+		if !loaded {
+			return
+		}
+		r.Logf("loaded %s into %s", file, args[0])
+	}
+}
+
+func test(r *reporter, dirs []string) {
+	if len(dirs) == 0 {
+		r.Fatal("test: no test directories")
+	}
+	clickhouse := ok.Connect(r, *dsn)
+	for _, dir := range dirs {
+		if clickhouse.RunFunctionalTests(dir) {
+			r.Logf("ok   %s", dir)
+		} else {
+			r.Logf("FAIL %s", dir)
+		}
+	}
+}
+
+func snapshot(r *reporter, args []string) {
+	clickhouse := ok.Connect(r, *dsn)
+	switch len(args) {
+	case 1:
+		schema, err := clickhouse.SchemaSnapshot(args[0])
+		if err != nil {
+			r.Fatal(err)
+		}
+		fmt.Print(schema)
+	case 2:
+		if clickhouse.AssertSchemaSnapshot(args[0], args[1]) {
+			r.Logf("ok   %s", args[1])
+		}
+	default:
+		r.Fatal("snapshot: expected a database and an optional golden file")
+	}
+}
+
+func clean(r *reporter, _ []string) {
+	objects, err := readState(*state)
+	if err != nil {
+		r.Fatal(err)
+	}
+	clickhouse := ok.Connect(r, *dsn)
+	clickhouse.Track(objects)
+	if clickhouse.Clear() {
+		if err := os.Remove(*state); err != nil && !os.IsNotExist(err) {
+			r.Error(err)
+		}
+	}
+}
+
+// saveState adds the objects created by the connection to the state file.
+func saveState(r *reporter, clickhouse ok.ClickHouse) {
+	objects, err := readState(*state)
+	if err != nil {
+		r.Error(err)
+		return
+	}
+	tracked := clickhouse.Tracked()
+	objects.Databases = append(objects.Databases, tracked.Databases...)
+	objects.Tables = append(objects.Tables, tracked.Tables...)
+	objects.Views = append(objects.Views, tracked.Views...)
+	objects.Dictionaries = append(objects.Dictionaries, tracked.Dictionaries...)
+	data, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		r.Error(err)
+		return
+	}
+	if err := ioutil.WriteFile(*state, append(data, '\n'), 0644); err != nil {
+		r.Errorf("could not write the state file: %v", err)
+	}
+}
+
+func readState(path string) (objects ok.Objects, _ error) {
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return objects, nil
+	case err != nil:
+		return objects, err
+	}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return objects, fmt.Errorf("could not read the state file '%s': %v", path, err)
+	}
+	return objects, nil
+}
+
+// reporter implements ok.T by printing to the output. Fatal and Skip stop the goroutine like testing.T does.
+type reporter struct {
+	name    string
+	out     io.Writer
+	failed  bool
+	skipped bool
+}
+
+func (r *reporter) Name() string {
+	return r.name
+}
+
+func (r *reporter) Failed() bool {
+	return r.failed
+}
+
+func (r *reporter) Error(args ...interface{}) {
+	r.failed = true
+	r.print(fmt.Sprint(args...))
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.print(fmt.Sprintf(format, args...))
+}
+
+func (r *reporter) Fatal(args ...interface{}) {
+	r.Error(args...)
+	runtime.Goexit()
+}
+
+func (r *reporter) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *reporter) Skipf(format string, args ...interface{}) {
+	r.skipped = true
+	r.print("skipped: " + fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+func (r *reporter) Logf(format string, args ...interface{}) {
+	r.print(fmt.Sprintf(format, args...))
+}
+
+func (r *reporter) print(message string) {
+	fmt.Fprintln(r.out, strings.TrimSuffix(message, "\n"))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ClickHouse-Ninja/ok"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	{
+		r := &reporter{out: &out}
+		assert.True(t, run(r, func() { r.Logf("done") }))
+		assert.False(t, r.Failed())
+	}
+	{
+		r := &reporter{out: &out}
+		assert.False(t, run(r, func() {
+			r.Fatalf("stopped: %d", 42)
+			r.Logf("unreachable")
+		}))
+		assert.True(t, r.Failed())
+	}
+	{
+		r := &reporter{out: &out}
+		assert.True(t, run(r, func() { r.Skipf("old server") }))
+		assert.False(t, r.Failed())
+	}
+	assert.Equal(t, "done\nstopped: 42\nskipped: old server\n", out.String())
+}
+
+func TestReadState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ok")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	if objects, err := readState(filepath.Join(dir, "missing.json")); assert.NoError(t, err) {
+		assert.Equal(t, ok.Objects{}, objects)
+	}
+	path := filepath.Join(dir, "state.json")
+	if assert.NoError(t, ioutil.WriteFile(path, []byte(`{"databases": ["db"], "tables": ["db.table"]}`), 0644)) {
+		if objects, err := readState(path); assert.NoError(t, err) {
+			assert.Equal(t, ok.Objects{Databases: []string{"db"}, Tables: []string{"db.table"}}, objects)
+		}
+	}
+	if assert.NoError(t, ioutil.WriteFile(path, []byte(`{`), 0644)) {
+		_, err := readState(path)
+		assert.Error(t, err)
+	}
+}
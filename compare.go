@@ -0,0 +1,358 @@
+package ok
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompareOptions controls how the rows of two result sets are compared.
+type CompareOptions struct {
+	// IgnoreOrder compares the rows as multisets, otherwise they must come in the same order.
+	IgnoreOrder bool
+	// Tolerance is the relative difference allowed between the values of Float and Decimal columns, e.g. 1e-9.
+	Tolerance float64
+	// Columns limits the comparison of tables to the columns, the fields of CSV files in order.
+	Columns []string
+	// Key are the columns identifying the rows of tables, rows with the same key are reported as changed.
+	Key []string
+}
+
+// maxReportedRows limits the rows reported on each side of a comparison.
+const maxReportedRows = 20
+
+// AssertQueriesEquivalent checks that the queries return the same rows, e.g. a query and its faster rewrite.
+// The counts and checksums of the rows are compared first, so large results are compared on the server,
+// the rows themselves are read only when the checksums differ: equal values of different types or
+// floats within the tolerance are still equivalent.
+func (c *clickhouse) AssertQueriesEquivalent(q1, q2 string, options CompareOptions) bool {
+	q1, q2 = rewriteQuery(q1, c.rewrite), rewriteQuery(q2, c.rewrite)
+	checksum1, err := c.checksum(q1, options.IgnoreOrder)
+	if err != nil {
+		c.test.Errorf("an error occurred while running the first query: %v", err)
+		return false
+	}
+	checksum2, err := c.checksum(q2, options.IgnoreOrder)
+	if err != nil {
+		c.test.Errorf("an error occurred while running the second query: %v", err)
+		return false
+	}
+	if checksum1 == checksum2 {
+		return true
+	}
+	types1, rows1, err := c.queryResult(q1)
+	if err != nil {
+		c.test.Errorf("an error occurred while running the first query: %v", err)
+		return false
+	}
+	types2, rows2, err := c.queryResult(q2)
+	if err != nil {
+		c.test.Errorf("an error occurred while running the second query: %v", err)
+		return false
+	}
+	if len(types1) != len(types2) {
+		c.test.Errorf("the first query returns %d columns, the second %d", len(types1), len(types2))
+		return false
+	}
+	if differences := compareRows(types1, rows1, rows2, options); len(differences) != 0 {
+		c.test.Errorf("the queries are not equivalent:\n%s", differences)
+		return false
+	}
+	return true
+}
+
+type resultChecksum struct {
+	rows, xor, sum uint64
+}
+
+// checksum returns the number of rows of the query and checksums of their hashes. The xor
+// and the sum of the hashes do not depend on the order of the rows, the row numbers are
+// hashed along when the order matters.
+func (c *clickhouse) checksum(query string, ignoreOrder bool) (checksum resultChecksum, err error) {
+	query = "(" + strings.TrimRight(query, "; \t\n") + ")"
+	if !ignoreOrder {
+		query = "(SELECT rowNumberInAllBlocks() AS _ok_row, * FROM " + query + ")"
+	}
+	err = c.conn.QueryRow("SELECT count(), groupBitXor(hash), sum(hash) FROM (SELECT cityHash64(*) AS hash FROM "+query+")").Scan(
+		&checksum.rows,
+		&checksum.xor,
+		&checksum.sum,
+	)
+	return checksum, err
+}
+
+// compareRows describes the differences between the rows formatted by queryResult, an empty string when
+// they are equal. The types of the first rows tell which columns the tolerance applies to.
+func compareRows(types []string, rows1, rows2 [][]string, options CompareOptions) string {
+	equal := func(row1, row2 []string) bool {
+		return rowsEqual(types, row1, row2, options.Tolerance)
+	}
+	if !options.IgnoreOrder {
+		if len(rows1) == len(rows2) {
+			same := true
+			for i := range rows1 {
+				if same = equal(rows1[i], rows2[i]); !same {
+					break
+				}
+			}
+			if same {
+				return ""
+			}
+		}
+		return diff(joinRows(rows1), joinRows(rows2))
+	}
+	only1, only2 := matchRows(types, rows1, rows2, options.Tolerance)
+	return reportRows("only in the first", only1) + reportRows("only in the second", only2)
+}
+
+// matchRows returns the rows of each side that have no equal row on the other side.
+func matchRows(types []string, rows1, rows2 [][]string, tolerance float64) (only1, only2 [][]string) {
+	counts := make(map[string]int, len(rows2))
+	for _, row := range rows2 {
+		counts[strings.Join(row, "\t")]++
+	}
+	for _, row := range rows1 {
+		if line := strings.Join(row, "\t"); counts[line] != 0 {
+			counts[line]--
+			continue
+		}
+		only1 = append(only1, row)
+	}
+	for _, row := range rows2 {
+		if line := strings.Join(row, "\t"); counts[line] != 0 {
+			counts[line]--
+			only2 = append(only2, row)
+		}
+	}
+	// the rows left may still be equal within the tolerance
+	for i := 0; i < len(only1); {
+		matched := false
+		for j := range only2 {
+			if matched = rowsEqual(types, only1[i], only2[j], tolerance); matched {
+				only1 = append(only1[:i], only1[i+1:]...)
+				only2 = append(only2[:j], only2[j+1:]...)
+				break
+			}
+		}
+		if !matched {
+			i++
+		}
+	}
+	return only1, only2
+}
+
+// rowsEqual reports whether the rows are equal, the Float and Decimal values within the relative tolerance.
+func rowsEqual(types, row1, row2 []string, tolerance float64) bool {
+	if len(row1) != len(row2) {
+		return false
+	}
+	for i := range row1 {
+		if row1[i] == row2[i] {
+			continue
+		}
+		columnType := unwrapType(types[i])
+		if tolerance == 0 || !(strings.HasPrefix(columnType, "Float") || strings.HasPrefix(columnType, "Decimal")) {
+			return false
+		}
+		v1, err1 := strconv.ParseFloat(row1[i], 64)
+		v2, err2 := strconv.ParseFloat(row2[i], 64)
+		if err1 != nil || err2 != nil || math.Abs(v1-v2) > tolerance*math.Max(math.Abs(v1), math.Abs(v2)) {
+			return false
+		}
+	}
+	return true
+}
+
+// reportRows lists the rows sorted, the first maxReportedRows of them.
+func reportRows(title string, rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+	sort.Strings(lines)
+	report := fmt.Sprintf("%d rows %s:\n", len(lines), title)
+	for i, line := range lines {
+		if i == maxReportedRows {
+			report += fmt.Sprintf("\t... %d more\n", len(lines)-maxReportedRows)
+			break
+		}
+		report += "\t" + line + "\n"
+	}
+	return report
+}
+
+// AssertTableEqualsCSV checks that the table, "database.table" or a table of the connection database, holds the rows of
+// the CSV file, found via the search path, in any order. The fields are converted like the fixtures loaded by CopyFromCSVFile,
+// DateTime values are in the server time zone.
+func (c *clickhouse) AssertTableEqualsCSV(table, path string, options CompareOptions) bool {
+	database, name := c.splitName(table)
+	columns, types, actual, err := c.tableRows(database, name, options.Columns)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading table '%s.%s': %v", database, name, err)
+		return false
+	}
+	if hasAggregateFunctions(types) {
+		c.test.Errorf("table '%s.%s' has AggregateFunction columns, compare the other columns", database, name)
+		return false
+	}
+	location, err := c.location()
+	if err != nil {
+		c.test.Errorf("could not get the server time zone: %v", err)
+		return false
+	}
+	file, err := c.openFile(path)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	defer file.Close()
+	values, err := csvToArgs(types, file, ',', location)
+	if err != nil {
+		c.test.Errorf("could not parse '%s': %v", path, err)
+		return false
+	}
+	expected := make([][]string, 0, len(values))
+	for _, row := range values {
+		fields := make([]string, 0, len(row))
+		for i, value := range row {
+			fields = append(fields, formatValue(types[i], value, false))
+		}
+		expected = append(expected, fields)
+	}
+	return c.assertTableRows(database+"."+name, path, columns, types, expected, actual, options)
+}
+
+// AssertTablesEqual checks that the tables hold the same rows in any order, reporting the rows of the
+// first table missing from the second one, the extra rows of the second table and the changed ones.
+func (c *clickhouse) AssertTablesEqual(a, b string, options CompareOptions) bool {
+	var (
+		databaseA, tableA = c.splitName(a)
+		databaseB, tableB = c.splitName(b)
+	)
+	columns, types, expected, err := c.tableRows(databaseA, tableA, options.Columns)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading table '%s.%s': %v", databaseA, tableA, err)
+		return false
+	}
+	_, _, actual, err := c.tableRows(databaseB, tableB, columns)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading table '%s.%s': %v", databaseB, tableB, err)
+		return false
+	}
+	return c.assertTableRows(databaseB+"."+tableB, databaseA+"."+tableA, columns, types, expected, actual, options)
+}
+
+// tableRows returns the columns of the table, all of them when none are given, their types and the rows.
+func (c *clickhouse) tableRows(database, table string, columns []string) ([]string, []string, [][]string, error) {
+	if len(columns) == 0 {
+		var err error
+		if columns, err = c.columnNames(database, table); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	types, err := c.columnTypes(database, table, columns)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, quoteIdentifier(column))
+	}
+	_, rows, err := c.queryResult("SELECT " + strings.Join(quoted, ", ") + " FROM " + database + "." + table)
+	return columns, types, rows, err
+}
+
+func (c *clickhouse) assertTableRows(table, source string, columns, types []string, expected, actual [][]string, options CompareOptions) bool {
+	key := make([]int, 0, len(options.Key))
+	for _, column := range options.Key {
+		i := indexOf(columns, column)
+		if i == -1 {
+			c.test.Errorf("key column '%s' is not compared", column)
+			return false
+		}
+		key = append(key, i)
+	}
+	differences, err := compareTables(columns, types, key, expected, actual, options.Tolerance)
+	if err != nil {
+		c.test.Errorf("could not compare table '%s' with '%s': %v", table, source, err)
+		return false
+	}
+	if len(differences) != 0 {
+		c.test.Errorf("table '%s' does not match '%s':\n%s", table, source, differences)
+		return false
+	}
+	return true
+}
+
+// compareTables describes the missing, extra and changed rows. Rows are matched by the key columns,
+// without a key changed rows are reported as missing and extra.
+func compareTables(columns, types []string, key []int, expected, actual [][]string, tolerance float64) (string, error) {
+	if len(key) == 0 {
+		missing, extra := matchRows(types, expected, actual, tolerance)
+		return reportRows("missing", missing) + reportRows("extra", extra), nil
+	}
+	keyOf := func(row []string) string {
+		values := make([]string, 0, len(key))
+		for _, i := range key {
+			values = append(values, row[i])
+		}
+		return "(" + strings.Join(values, ", ") + ")"
+	}
+	index := func(rows [][]string, side string) (map[string][]string, error) {
+		keyed := make(map[string][]string, len(rows))
+		for _, row := range rows {
+			k := keyOf(row)
+			if _, found := keyed[k]; found {
+				return nil, fmt.Errorf("key %s is not unique in the %s rows", k, side)
+			}
+			keyed[k] = row
+		}
+		return keyed, nil
+	}
+	expectedRows, err := index(expected, "expected")
+	if err != nil {
+		return "", err
+	}
+	actualRows, err := index(actual, "actual")
+	if err != nil {
+		return "", err
+	}
+	var (
+		missing, extra, changed [][]string
+	)
+	for _, row := range expected {
+		other, found := actualRows[keyOf(row)]
+		switch {
+		case !found:
+			missing = append(missing, row)
+		case !rowsEqual(types, row, other, tolerance):
+			var fields []string
+			for i := range row {
+				if !rowsEqual(types[i:i+1], row[i:i+1], other[i:i+1], tolerance) {
+					fields = append(fields, fmt.Sprintf("%s: %s -> %s", columns[i], row[i], other[i]))
+				}
+			}
+			changed = append(changed, []string{"key " + keyOf(row) + ": " + strings.Join(fields, ", ")})
+		}
+	}
+	for _, row := range actual {
+		if _, found := expectedRows[keyOf(row)]; !found {
+			extra = append(extra, row)
+		}
+	}
+	return reportRows("missing", missing) + reportRows("extra", extra) + reportRows("changed", changed), nil
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,122 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareRows(t *testing.T) {
+	var (
+		types = []string{"String", "Float64"}
+		rows  = [][]string{{"a", "1"}, {"b", "0.3"}, {"b", "0.3"}}
+	)
+	assert.Empty(t, compareRows(types, rows, [][]string{{"a", "1"}, {"b", "0.3"}, {"b", "0.3"}}, CompareOptions{}))
+	assert.NotEmpty(t, compareRows(types, rows, [][]string{{"b", "0.3"}, {"a", "1"}, {"b", "0.3"}}, CompareOptions{}))
+	assert.Empty(t, compareRows(types, rows, [][]string{{"b", "0.3"}, {"a", "1"}, {"b", "0.3"}}, CompareOptions{IgnoreOrder: true}))
+	assert.Empty(t, compareRows(types, rows, [][]string{{"a", "1"}, {"b", "0.30000000000000004"}, {"b", "0.3"}}, CompareOptions{Tolerance: 1e-9}))
+	assert.Empty(t, compareRows(types, rows, [][]string{{"b", "0.30000000000000004"}, {"b", "0.3"}, {"a", "1"}}, CompareOptions{IgnoreOrder: true, Tolerance: 1e-9}))
+	assert.Equal(t,
+		"1 rows only in the first:\n\tb\t0.3\n2 rows only in the second:\n\ta\t1\n\tc\t0.3\n",
+		compareRows(types, rows, [][]string{{"c", "0.3"}, {"a", "1"}, {"a", "1"}, {"b", "0.3"}}, CompareOptions{IgnoreOrder: true}),
+	)
+	assert.Equal(t,
+		"1 rows only in the first:\n\ta\t1\n",
+		compareRows([]string{"String", "String"}, rows, rows[1:], CompareOptions{IgnoreOrder: true, Tolerance: 1}),
+	)
+}
+
+func TestQueriesEquivalent(t *testing.T) {
+	recorder := errorRecorder{T: t}
+	clickhouse := Connect(&recorder, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	ddl := `
+		CREATE DATABASE equivalent_tester;
+		CREATE TABLE equivalent_tester.events (
+			user  String,
+			value Float64
+		) Engine Memory;
+		INSERT INTO equivalent_tester.events SELECT toString(number % 100), number / 3 FROM system.numbers LIMIT 100000;
+	`
+	if !assert.NoError(t, clickhouse.Exec(ddl)) {
+		return
+	}
+	assert.True(t, clickhouse.AssertQueriesEquivalent(
+		"SELECT user, count() FROM equivalent_tester.events GROUP BY user ORDER BY user",
+		"SELECT user, toUInt32(count()) FROM equivalent_tester.events GROUP BY user ORDER BY user",
+		CompareOptions{},
+	))
+	assert.True(t, clickhouse.AssertQueriesEquivalent(
+		"SELECT user, sum(value) FROM equivalent_tester.events GROUP BY user",
+		"SELECT user, sumKahan(value) FROM equivalent_tester.events GROUP BY user",
+		CompareOptions{IgnoreOrder: true, Tolerance: 1e-9},
+	))
+	assert.Empty(t, recorder.errors)
+	assert.False(t, clickhouse.AssertQueriesEquivalent(
+		"SELECT user FROM equivalent_tester.events GROUP BY user",
+		"SELECT user FROM equivalent_tester.events WHERE user != '42' GROUP BY user",
+		CompareOptions{IgnoreOrder: true},
+	))
+	if assert.Len(t, recorder.errors, 1) {
+		assert.Equal(t, "the queries are not equivalent:\n1 rows only in the first:\n\t42\n", recorder.errors[0])
+	}
+}
+
+func TestCompareTables(t *testing.T) {
+	var (
+		columns  = []string{"id", "name", "score"}
+		types    = []string{"UInt64", "String", "Float64"}
+		expected = [][]string{{"1", "a", "1.5"}, {"2", "b", "2.5"}, {"3", "c", "3.5"}}
+	)
+	differences, err := compareTables(columns, types, []int{0}, expected, [][]string{{"3", "c", "3.5"}, {"1", "a", "1.5000000001"}, {"2", "B", "2"}}, 1e-9)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1 rows changed:\n\tkey (2): name: b -> B, score: 2.5 -> 2\n", differences)
+	}
+	differences, err = compareTables(columns, types, []int{0}, expected, [][]string{{"4", "d", "4.5"}, {"1", "a", "1.5"}, {"3", "c", "3.5"}}, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1 rows missing:\n\t2\tb\t2.5\n1 rows extra:\n\t4\td\t4.5\n", differences)
+	}
+	differences, err = compareTables(columns, types, nil, expected, [][]string{{"1", "a", "1.5"}, {"3", "c", "3.5"}, {"2", "B", "2.5"}}, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1 rows missing:\n\t2\tb\t2.5\n1 rows extra:\n\t2\tB\t2.5\n", differences)
+	}
+	_, err = compareTables(columns, types, []int{1}, expected, [][]string{{"1", "a", "1.5"}, {"2", "a", "2.5"}}, 0)
+	if assert.Error(t, err) {
+		assert.Equal(t, "key (a) is not unique in the actual rows", err.Error())
+	}
+}
+
+func TestTablesEqual(t *testing.T) {
+	recorder := errorRecorder{T: t}
+	clickhouse := Connect(&recorder, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	ddl := `
+		CREATE DATABASE tables_tester;
+		CREATE TABLE tables_tester.users (
+			id         UInt64,
+			created_at Date,
+			name       String,
+			score      Float64,
+			updated_at DateTime
+		) Engine Memory;
+		CREATE TABLE tables_tester.copy AS tables_tester.users;
+		INSERT INTO tables_tester.users SELECT 3, toDate('2019-02-10'), 'c', 3.5, toDateTime('2019-02-10 23:30:00')
+			UNION ALL SELECT 1, toDate('2019-02-09'), 'a', 1.5, toDateTime('2019-02-09 10:10:10')
+			UNION ALL SELECT 2, toDate('2019-02-09'), 'b', 2.5, toDateTime('2019-02-09 00:00:00');
+		INSERT INTO tables_tester.copy SELECT id, created_at, name, if(id = 2, 2, score), updated_at FROM tables_tester.users WHERE id != 3;
+	`
+	if !assert.NoError(t, clickhouse.Exec(ddl)) {
+		return
+	}
+	options := CompareOptions{Key: []string{"id"}}
+	assert.True(t, clickhouse.AssertTableEqualsCSV("tables_tester.users", "testdata/compare/users.csv", options))
+	assert.Empty(t, recorder.errors)
+	assert.False(t, clickhouse.AssertTablesEqual("tables_tester.users", "tables_tester.copy", options))
+	if assert.Len(t, recorder.errors, 1) {
+		assert.Equal(t, "table 'tables_tester.copy' does not match 'tables_tester.users':\n"+
+			"1 rows missing:\n\t3\t2019-02-10\tc\t3.5\t2019-02-10 23:30:00\n"+
+			"1 rows changed:\n\tkey (2): score: 2.5 -> 2\n",
+			recorder.errors[0],
+		)
+	}
+}
@@ -2,6 +2,7 @@ package ok
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,81 +10,158 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"testing"
+	"time"
 )
 
+var update = flag.Bool("ok.update", false, "update golden files instead of comparing with them")
+
+// T is the part of testing.T the package reports through. Besides *testing.T it can be
+// implemented by tools that use the package outside of go test.
+type T interface {
+	Name() string
+	Failed() bool
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fatal(args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Skipf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+}
+
 type ClickHouse interface {
 	DB() *sql.DB
 	Version() (*Version, error)
+	RequireVersion(constraint string)
 	Exec(query string) error
 	ExecFromFile(path string) error
+	AssertErrorCode(err error, code ErrorCode) bool
+	ExpectExecError(query string, code ErrorCode) bool
 	SetSearchPath(path ...string)
+	RunFunctionalTests(dir string) bool
+	SetRewrite(rewrite Rewrite)
+	WithSettings(settings map[string]interface{}) ClickHouse
+	WithProfile(profile string) ClickHouse
+	Settings(settings map[string]interface{}, fn func()) bool
+	AssertSettings(expected map[string]interface{}) bool
+	SetWaitTimeout(timeout time.Duration)
+	WaitMutations(database, table string) bool
+	OptimizeFinal(database, table string) bool
+	FlushBuffer(database, table string) bool
+	WaitDictionaryLoaded(dictionary string) bool
+	Eventually(query string, expected interface{}, timeout time.Duration) bool
+	AssertPipeline(pipeline Pipeline) bool
 	ShowDatabases() ([]string, error)
 	ShowTables(from ...string) ([]string, error)
 	DatabaseExists(database string) bool
 	TableExists(database, table string) bool
 	DictionaryExists(dictionary string) bool
 	ReloadDictionary(dictionary string) bool
+	HasFunction(name string) bool
+	HasTableEngine(name string) bool
+	HasDataType(name string) bool
+	HasSetting(name string) bool
+	HasFormat(name string) bool
+	HasDictionaryLayout(name string) bool
+	RequireFunction(name string)
+	RequireTableEngine(name string)
+	RequireDataType(name string)
+	RequireSetting(name string)
+	RequireFormat(name string)
+	RequireDictionaryLayout(name string)
 	CopyFromCSVReader(r io.Reader, sql string) bool
 	CopyFromTSVReader(r io.Reader, sql string) bool
 	CopyFromCSVFile(path, sql string) bool
 	CopyFromTSVFile(path, sql string) bool
+	CopyFromJSONReader(r io.Reader, sql string) bool
+	CopyFromJSONFile(path, sql string) bool
+	InsertStructs(table string, slice interface{}) bool
+	Generate(table string, generator Generator) bool
+	AssertProperty(property Property) bool
+	AssertQueriesEquivalent(q1, q2 string, options CompareOptions) bool
+	AssertTableEqualsCSV(table, path string, options CompareOptions) bool
+	AssertTablesEqual(a, b string, options CompareOptions) bool
+	Select(dest interface{}, query string, args ...interface{}) error
+	SelectMaps(query string, args ...interface{}) ([]map[string]interface{}, error)
+	SelectColumn(dest interface{}, query string, args ...interface{}) error
 	DropDatabase(database string) bool
 	DropTable(database, table string) bool
+	DropDictionary(database, dictionary string) bool
+	CreateDictionary(fixture DictionaryFixture) bool
+	CreateDictionaryFromCSVFile(fixture DictionaryFixture, path string) bool
+	CreateDictionaryFromTSVFile(fixture DictionaryFixture, path string) bool
+	AssertDictGet(dictionary, attribute string, key, expected interface{}) bool
+	MigrateUp(dir string) bool
+	MigrateDown(dir string) bool
+	MigrateTo(dir string, version uint64) bool
+	MigrateVerify(dir string) bool
+	MigrationVersion() (uint64, error)
+	TableSchema(database, table string) (*TableSchema, error)
+	AssertTableSchema(database, table string, expected *TableSchema) bool
+	AssertTableSchemaDDL(database, table, ddl string) bool
+	SchemaSnapshot(database string) (string, error)
+	AssertSchemaSnapshot(database, golden string) bool
+	QueriesExecuted() ([]QueryLogEntry, error)
+	AssertReadRowsAtMost(query string, rows uint64) bool
+	AssertMemoryUsageBelow(query string, bytes uint64) bool
+	AssertUsedIndex(query string) bool
+	AssertBaseline(baseline Baseline) bool
+	Proxy() *Proxy
+	Tracked() Objects
+	Track(objects Objects)
 	Clear() bool
 }
 
-type Version struct {
-	Major int
-	Minor int
-	Patch int
-}
-
-func (v *Version) Less(v2 *Version) bool {
-	var (
-		majorEq = v.Major == v2.Major
-		minorEq = majorEq && v.Minor == v2.Minor
-	)
-	return v.Major < v2.Major || (majorEq && v.Minor < v2.Minor) || (minorEq && v.Patch < v2.Patch)
-}
-
-func (v *Version) Equal(v2 *Version) bool {
-	return v.Major == v2.Major && v.Minor == v2.Minor && v.Patch == v2.Patch
-}
-
-func (v *Version) String() string {
-	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
-}
-
-func Connect(test *testing.T, dsn string) ClickHouse {
-	conn, err := sql.Open("clickhouse", dsn)
+func Connect(test T, dsn string) ClickHouse {
+	open, err := sql.Open("clickhouse", dsn)
 	if err != nil {
 		test.Fatalf("could not open ClickHouse driver: %v", err)
 	}
-	conn.SetMaxOpenConns(1)
+	defer open.Close()
 	var (
 		url, _   = url.Parse(dsn)
 		database = "default"
+		settings = &connSettings{
+			tag: fmt.Sprintf("ok:%s:%d", test.Name(), time.Now().UnixNano()),
+		}
+		conn = sql.OpenDB(&connector{
+			dsn:      dsn,
+			driver:   open.Driver(),
+			settings: settings,
+		})
 	)
+	conn.SetMaxOpenConns(1)
 	if value := url.Query().Get("database"); len(value) != 0 {
 		database = value
 	}
 	return &clickhouse{
 		test:       test,
+		dsn:        dsn,
 		conn:       conn,
 		database:   database,
+		settings:   settings,
 		searchPath: []string{"", "."},
 	}
 }
 
 type clickhouse struct {
-	test       *testing.T
-	conn       *sql.DB
-	database   string
-	searchPath []string
-	clear      struct {
-		databases []string
-		tables    [][]string
+	test         T
+	dsn          string
+	conn         *sql.DB
+	database     string
+	searchPath   []string
+	rewrite      Rewrite
+	version      *Version
+	timezone     *time.Location
+	features     map[string]*featureNames
+	dictionaries map[string]dictionaryKey
+	settings     *connSettings
+	waitTimeout  time.Duration
+	clear        struct {
+		databases    []string
+		tables       [][]string
+		views        [][]string
+		dictionaries [][]string
+		proxies      []*Proxy
 	}
 }
 
@@ -95,21 +173,6 @@ func (c *clickhouse) SetSearchPath(path ...string) {
 	c.searchPath = path
 }
 
-func (c *clickhouse) Version() (*Version, error) {
-	var version Version
-	const query = `
-		WITH (splitByChar('.',version())) AS version
-		SELECT
-			toInt16(version[1])   AS major
-			, toInt16(version[2]) AS minor
-			, toInt16(version[3]) AS patch
-	`
-	if err := c.conn.QueryRow(query).Scan(&version.Major, &version.Minor, &version.Patch); err != nil {
-		return nil, err
-	}
-	return &version, nil
-}
-
 func (c *clickhouse) ShowDatabases() (databases []string, _ error) {
 	rows, err := c.conn.Query("SHOW DATABASES")
 	if err != nil {
@@ -165,7 +228,7 @@ func (c *clickhouse) TableExists(database, table string) bool {
 }
 
 func (c *clickhouse) DictionaryExists(dictionary string) bool {
-	exists, err := c.exists("SELECT COUNT() FROM system.dictionaries WHERE name = ?", dictionary)
+	exists, err := c.exists("SELECT count() FROM system.dictionaries WHERE " + dictionaryWhere(dictionary))
 	if err != nil {
 		c.test.Errorf("an error occurred while checking the dictionary: %v", err)
 		return false
@@ -173,20 +236,51 @@ func (c *clickhouse) DictionaryExists(dictionary string) bool {
 	return exists
 }
 
+// location returns the time zone of the server, the driver reads DateTime values in it
+// and the text form of DateTime values in fixtures is parsed in it like the server does.
+func (c *clickhouse) location() (*time.Location, error) {
+	if c.timezone != nil {
+		return c.timezone, nil
+	}
+	var name string
+	if err := c.conn.QueryRow("SELECT timezone()").Scan(&name); err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	c.timezone = location
+	return location, nil
+}
+
 func (c *clickhouse) exists(query string, args ...interface{}) (bool, error) {
 	var count int
 	if err := c.conn.QueryRow(query, args...).Scan(&count); err != nil {
 		return false, err
 	}
-	return count == 1, nil
+	return count > 0, nil
 }
 
+// ReloadDictionary reloads the dictionary and waits until it is loaded.
+// Names of DDL dictionaries, "database.dictionary", are not quoted.
 func (c *clickhouse) ReloadDictionary(dictionary string) bool {
-	if _, err := c.conn.Exec("SYSTEM RELOAD DICTIONARY " + quote(dictionary)); err != nil {
+	name := quote(dictionary)
+	if parts := strings.SplitN(dictionary, ".", 2); len(parts) == 2 {
+		ddl, err := c.exists("SELECT count() FROM system.dictionaries WHERE database = ? AND name = ?", parts[0], parts[1])
+		if err != nil {
+			c.test.Errorf("an error occurred while looking up dictionary: %v", err)
+			return false
+		}
+		if ddl {
+			name = dictionary
+		}
+	}
+	if _, err := c.conn.Exec("SYSTEM RELOAD DICTIONARY " + name); err != nil {
 		c.test.Errorf("an error occurred while reloading dictionary: %v", err)
 		return false
 	}
-	return true
+	return c.WaitDictionaryLoaded(dictionary)
 }
 
 func (c *clickhouse) DropDatabase(database string) bool {
@@ -208,20 +302,46 @@ func (c *clickhouse) DropTable(database, table string) bool {
 func (c *clickhouse) Exec(query string) error {
 	for _, query := range strings.Split(query, ";\n") {
 		if query = strings.TrimSpace(query); len(query) != 0 {
-			if _, err := c.conn.Exec(query); err != nil {
+			query = rewriteQuery(query, c.rewrite)
+			if err := c.exec(query); err != nil {
 				return err
 			}
 			if database := extractCreateDatabase(query); len(database) != 0 {
 				c.clear.databases = append(c.clear.databases, database)
 			}
-			if database, table := extractCreateTable(query); len(table) != 0 {
-				c.clear.tables = append(c.clear.tables, []string{database, table})
+			var (
+				dictionaryDatabase, dictionary = extractCreateDictionary(query)
+				viewDatabase, view             = extractCreateView(query)
+			)
+			switch {
+			case len(dictionary) != 0:
+				c.clear.dictionaries = append(c.clear.dictionaries, []string{dictionaryDatabase, dictionary})
+			case len(view) != 0:
+				c.clear.views = append(c.clear.views, []string{viewDatabase, view})
+			default:
+				if database, table := extractCreateTable(query); len(table) != 0 {
+					c.clear.tables = append(c.clear.tables, []string{database, table})
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// exec runs a single statement. The driver runs statements starting with "INSERT INTO" only in
+// batch mode, where it sends the data itself, unless they contain a SELECT. It looks at the first
+// words only, so inserts with inline data are sent behind a comment and the server parses the data.
+func (c *clickhouse) exec(query string) error {
+	if firstKeyword(query) == "INSERT" {
+		switch insertSource(query) {
+		case "VALUES", "FORMAT":
+			query = "/* inline data */ " + skipComments(query)
+		}
+	}
+	_, err := c.conn.Exec(query)
+	return err
+}
+
 func (c *clickhouse) ExecFromFile(path string) (err error) {
 	var data []byte
 	for _, searchPath := range c.searchPath {
@@ -259,6 +379,37 @@ func (c *clickhouse) copyFromFile(path, query string, comma rune) bool {
 }
 
 func (c *clickhouse) copyFromReader(r io.Reader, query string, comma rune) bool {
+	return c.copy(query, func(_, types []string) ([][]interface{}, error) {
+		location, err := c.location()
+		if err != nil {
+			return nil, err
+		}
+		return csvToArgs(types, r, comma, location)
+	})
+}
+
+func (c *clickhouse) CopyFromJSONReader(r io.Reader, query string) bool {
+	return c.copy(query, func(columns, types []string) ([][]interface{}, error) {
+		location, err := c.location()
+		if err != nil {
+			return nil, err
+		}
+		return jsonToArgs(columns, types, r, location)
+	})
+}
+
+func (c *clickhouse) CopyFromJSONFile(path, query string) bool {
+	file, err := c.openFile(path)
+	if err != nil {
+		c.test.Errorf("could not open file: %v", err)
+		return false
+	}
+	defer file.Close()
+	return c.CopyFromJSONReader(file, query)
+}
+
+// copy inserts the rows read for the columns of the insert query, all columns of the table by default.
+func (c *clickhouse) copy(query string, read func(columns, types []string) ([][]interface{}, error)) bool {
 	database, table, columns := parseQuery(query)
 	if len(table) == 0 {
 		c.test.Error("error while parsing query: cannot find table name")
@@ -267,42 +418,124 @@ func (c *clickhouse) copyFromReader(r io.Reader, query string, comma rune) bool
 	if len(database) == 0 {
 		database = c.database
 	}
+	if len(columns) == 0 {
+		names, err := c.columnNames(database, table)
+		if err != nil {
+			c.test.Error(err)
+			return false
+		}
+		columns = names
+	}
 	columnTypes, err := c.columnTypes(database, table, columns)
 	if err != nil {
 		c.test.Error(err)
 		return false
 	}
-	rows, err := csvToArgs(columnTypes, r, comma)
+	rows, err := read(columns, columnTypes)
 	if err != nil {
 		c.test.Error(err)
 		return false
 	}
-	scope, err := c.conn.Begin()
+	if hasAggregateFunctions(columnTypes) {
+		err = c.copyThroughStaging(database, table, columns, columnTypes, rows)
+	} else {
+		err = c.insert(query, rows)
+	}
 	if err != nil {
 		c.test.Error(err)
 		return false
 	}
+	return true
+}
+
+func (c *clickhouse) insert(query string, rows [][]interface{}) error {
+	scope, err := c.conn.Begin()
+	if err != nil {
+		return err
+	}
 	block, err := scope.Prepare(query)
 	if err != nil {
-		c.test.Error(err)
-		return false
+		scope.Rollback()
+		return err
 	}
 	for _, row := range rows {
 		if _, err := block.Exec(row...); err != nil {
-			c.test.Error(err)
-			return false
+			scope.Rollback()
+			return err
 		}
 	}
-	if err := scope.Commit(); err != nil {
-		c.test.Error(err)
-		return false
+	return scope.Commit()
+}
+
+// Objects lists objects created through Exec by their qualified names.
+type Objects struct {
+	Databases    []string `json:"databases,omitempty"`
+	Tables       []string `json:"tables,omitempty"`
+	Views        []string `json:"views,omitempty"`
+	Dictionaries []string `json:"dictionaries,omitempty"`
+}
+
+// Tracked returns the objects Clear is going to drop.
+func (c *clickhouse) Tracked() Objects {
+	qualify := func(tuples [][]string) (names []string) {
+		for _, tuple := range tuples {
+			database := c.database
+			if len(tuple[0]) != 0 {
+				database = tuple[0]
+			}
+			names = append(names, database+"."+tuple[1])
+		}
+		return names
 	}
-	return true
+	return Objects{
+		Databases:    append([]string(nil), c.clear.databases...),
+		Tables:       qualify(c.clear.tables),
+		Views:        qualify(c.clear.views),
+		Dictionaries: qualify(c.clear.dictionaries),
+	}
+}
+
+// Track adds objects created elsewhere, e.g. by an earlier run of the ok tool, to the ones Clear drops.
+func (c *clickhouse) Track(objects Objects) {
+	split := func(names []string) (tuples [][]string) {
+		for _, name := range names {
+			database, table := c.splitName(name)
+			tuples = append(tuples, []string{database, table})
+		}
+		return tuples
+	}
+	c.clear.databases = append(c.clear.databases, objects.Databases...)
+	c.clear.tables = append(c.clear.tables, split(objects.Tables)...)
+	c.clear.views = append(c.clear.views, split(objects.Views)...)
+	c.clear.dictionaries = append(c.clear.dictionaries, split(objects.Dictionaries)...)
+}
+
+// tracked reports whether Clear drops the table.
+func (c *clickhouse) tracked(database, table string) bool {
+	for _, tuple := range c.clear.tables {
+		if tuple[0] == database && tuple[1] == table {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *clickhouse) Clear() bool {
 	ok := true
-	for _, tuple := range c.clear.tables {
+	for _, proxy := range c.clear.proxies {
+		proxy.Close()
+	}
+	for _, tuple := range c.clear.dictionaries {
+		database := c.database
+		if len(tuple[0]) != 0 {
+			database = tuple[0]
+		}
+		if !c.DropDictionary(database, tuple[1]) {
+			ok = false
+		}
+	}
+	// views are dropped before the tables they read from and write to
+	for _, tuple := range append(append([][]string(nil), c.clear.views...), c.clear.tables...) {
 		database := c.database
 		if len(tuple[0]) != 0 {
 			database = tuple[0]
@@ -461,3 +694,40 @@ func extractCreateTable(ddl string) (string, string) {
 	}
 	return "", ""
 }
+
+func extractCreateDictionary(ddl string) (string, string) {
+	return extractCreateObject(ddl, "DICTIONARY")
+}
+
+func extractCreateView(ddl string) (string, string) {
+	return extractCreateObject(ddl, "VIEW")
+}
+
+// extractCreateObject returns the name of the object of the kind the CREATE statement creates.
+func extractCreateObject(ddl, kind string) (string, string) {
+	fields := strings.Fields(ddl)
+	if len(fields) < 3 || strings.ToUpper(fields[0]) != "CREATE" {
+		return "", ""
+	}
+	for i, field := range fields[1:] {
+		switch strings.ToUpper(field) {
+		case "OR", "REPLACE", "MATERIALIZED", "LIVE":
+			continue
+		case kind:
+			for _, field := range fields[i+2:] {
+				if field = strings.TrimSpace(strings.TrimSuffix(field, "(")); len(field) != 0 {
+					switch strings.ToUpper(field) {
+					case "IF", "NOT", "EXISTS":
+					default:
+						if parts := strings.Split(field, "."); len(parts) == 2 {
+							return parts[0], parts[1]
+						}
+						return "", field
+					}
+				}
+			}
+		}
+		break
+	}
+	return "", ""
+}
@@ -134,3 +134,53 @@ func TestExtractCreateTable(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractCreateDictionary(t *testing.T) {
+	assets := map[string][]string{
+		"CREATE DICTIONARY dict (id UInt64) PRIMARY KEY id":           []string{"", "dict"},
+		"CREATE DICTIONARY db.dict(":                                  []string{"db", "dict"},
+		"CREATE OR REPLACE DICTIONARY IF NOT EXISTS db.dict (":        []string{"db", "dict"},
+		"CREATE TABLE db.table (id UInt64) Engine Dictionary(dict)":   []string{"", ""},
+		"CREATE TABLE db.table (id UInt64) Engine Memory":             []string{"", ""},
+		"SELECT * FROM system.dictionaries WHERE name = 'DICTIONARY'": []string{"", ""},
+	}
+	for src, expected := range assets {
+		database, dictionary := extractCreateDictionary(src)
+		{
+			assert.Equal(t, expected, []string{database, dictionary})
+		}
+	}
+}
+
+func TestExtractCreateView(t *testing.T) {
+	assets := map[string][]string{
+		"CREATE VIEW db.view AS SELECT * FROM table":                            []string{"db", "view"},
+		"CREATE MATERIALIZED VIEW IF NOT EXISTS db.mv TO db.target AS SELECT 1": []string{"db", "mv"},
+		"CREATE MATERIALIZED VIEW mv Engine Memory AS SELECT * FROM db.table":   []string{"", "mv"},
+		"CREATE OR REPLACE VIEW view AS SELECT 1":                               []string{"", "view"},
+		"CREATE TABLE db.table (id UInt64) Engine Memory":                       []string{"", ""},
+	}
+	for src, expected := range assets {
+		database, view := extractCreateView(src)
+		{
+			assert.Equal(t, expected, []string{database, view})
+		}
+	}
+}
+
+func TestTracked(t *testing.T) {
+	c := &clickhouse{database: "default"}
+	c.Track(Objects{
+		Databases:    []string{"db"},
+		Tables:       []string{"db.table", "table"},
+		Views:        []string{"db.view"},
+		Dictionaries: []string{"db.dictionary"},
+	})
+	assert.Equal(t, [][]string{{"db", "table"}, {"default", "table"}}, c.clear.tables)
+	assert.Equal(t, Objects{
+		Databases:    []string{"db"},
+		Tables:       []string{"db.table", "default.table"},
+		Views:        []string{"db.view"},
+		Dictionaries: []string{"db.dictionary"},
+	}, c.Tracked())
+}
@@ -2,6 +2,7 @@ package ok
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
@@ -10,7 +11,9 @@ import (
 	"time"
 )
 
-func csvToArgs(types []string, r io.Reader, comma rune) (result [][]interface{}, err error) {
+// csvToArgs converts the fields of the rows to the values of the column types,
+// DateTime values are in the location.
+func csvToArgs(types []string, r io.Reader, comma rune, location *time.Location) (result [][]interface{}, err error) {
 	reader := csv.NewReader(r)
 	reader.Comma = comma
 	for columns := []string{}; ; {
@@ -28,13 +31,17 @@ func csvToArgs(types []string, r io.Reader, comma rune) (result [][]interface{},
 			row   = make([]interface{}, 0, len(types))
 		)
 		for i, t := range types {
-			converter, err := converterFactory(t)
+			converter, err := converterFactory(t, location)
 			if err != nil {
 				return nil, err
 			}
 			if value, err = converter(columns[i]); err != nil {
 				return nil, err
 			}
+			if values, ok := value.(multiValue); ok {
+				row = append(row, values...)
+				continue
+			}
 			row = append(row, value)
 		}
 		result = append(result, row)
@@ -42,13 +49,96 @@ func csvToArgs(types []string, r io.Reader, comma rune) (result [][]interface{},
 	return result, nil
 }
 
+// jsonToArgs converts JSONEachRow objects, values are converted from their text form like CSV fields.
+func jsonToArgs(columns, types []string, r io.Reader, location *time.Location) (result [][]interface{}, err error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		fields := make([]string, 0, len(columns))
+		for i, column := range columns {
+			value, found := object[column]
+			if !found {
+				return nil, fmt.Errorf("row %d: column '%s' is missing", len(result)+1, column)
+			}
+			field, err := jsonField(types[i], value)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: column '%s': %v", len(result)+1, column, err)
+			}
+			fields = append(fields, field)
+		}
+		var buf strings.Builder
+		writer := csv.NewWriter(&buf)
+		writer.Write(fields)
+		writer.Flush()
+		rows, err := csvToArgs(types, strings.NewReader(buf.String()), ',', location)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", len(result)+1, err)
+		}
+		result = append(result, rows...)
+	}
+	return result, nil
+}
+
+// jsonField formats a JSON value of the column type the way a CSV fixture holds it.
+// Strings inside arrays are quoted and escaped like the ClickHouse array literals.
+func jsonField(columnType string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case []interface{}:
+		var (
+			elementType = strings.TrimSuffix(strings.TrimPrefix(unwrapType(columnType), "Array("), ")")
+			elements    = make([]string, 0, len(v))
+		)
+		for _, element := range v {
+			field, err := jsonField(elementType, element)
+			if err != nil {
+				return "", err
+			}
+			if _, isString := element.(string); isString {
+				field = quote(field)
+			}
+			elements = append(elements, field)
+		}
+		return "[" + strings.Join(elements, ",") + "]", nil
+	case nil:
+		if strings.HasPrefix(strings.TrimPrefix(columnType, "LowCardinality("), "Nullable(") {
+			return `\N`, nil
+		}
+		return "", fmt.Errorf("null values are only supported for Nullable columns")
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
 type converter func(src string) (interface{}, error)
 
-func converterFactory(t string) (converter, error) {
+// unescapeQuoted unescapes the quoted strings of array literals, see quote.
+var unescapeQuoted = strings.NewReplacer(`\\`, `\`, `\'`, `'`)
+
+// multiValue is returned by converters of columns that are loaded into several staging columns.
+type multiValue []interface{}
+
+func converterFactory(t string, location *time.Location) (converter, error) {
 	switch t {
 	case "String", "UUID":
 		return func(src string) (interface{}, error) { return src, nil }, nil
-	case "Date", "DateTime",
+	case "DateTime":
+		return dateTime(location), nil
+	case "Date",
 		"Float32", "Float64",
 		"Int8", "Int16", "Int32", "Int64",
 		"UInt8", "UInt16", "UInt32", "UInt64":
@@ -56,31 +146,52 @@ func converterFactory(t string) (converter, error) {
 	default:
 		switch {
 		case strings.HasPrefix(t, "Array"):
-			base, err := converterFactory(t[6 : len(t)-1])
+			base, err := converterFactory(t[6:len(t)-1], location)
+			if err != nil {
+				return nil, err
+			}
+			sliceType, _ := columnGoType(t)
+			return arrayT(base, sliceType), nil
+		case strings.HasPrefix(t, "Nullable("):
+			base, err := converterFactory(t[len("Nullable("):len(t)-1], location)
 			if err != nil {
 				return nil, err
 			}
-			return arrayT(base), nil
-		case strings.HasPrefix(t, "Enum"):
+			return func(src string) (interface{}, error) {
+				if src == `\N` {
+					return nil, nil
+				}
+				return base(src)
+			}, nil
+		case strings.HasPrefix(t, "LowCardinality("):
+			return converterFactory(t[len("LowCardinality("):len(t)-1], location)
+		case strings.HasPrefix(t, "DateTime("):
+			return dateTime(location), nil
+		case strings.HasPrefix(t, "Decimal"):
+			return converters["Float64"], nil
+		case strings.HasPrefix(t, "Enum"), strings.HasPrefix(t, "FixedString("):
 			return func(src string) (interface{}, error) { return src, nil }, nil
+		case strings.HasPrefix(t, "AggregateFunction"), strings.HasPrefix(t, "SimpleAggregateFunction"):
+			if f, ok := parseAggregateFunction(t); ok {
+				return f.converter(location)
+			}
 		}
 	}
 	return nil, fmt.Errorf("converter '%s' not found", t)
 }
 
 var converters = map[string]converter{
-	"Date":     date,
-	"DateTime": dateTime,
-	"Int8":     intT(8, func(v int64) interface{} { return int8(v) }),
-	"Int16":    intT(16, func(v int64) interface{} { return int16(v) }),
-	"Int32":    intT(32, func(v int64) interface{} { return int32(v) }),
-	"Int64":    intT(64, func(v int64) interface{} { return int64(v) }),
-	"UInt8":    uintT(8, func(v uint64) interface{} { return uint8(v) }),
-	"UInt16":   uintT(16, func(v uint64) interface{} { return uint16(v) }),
-	"UInt32":   uintT(32, func(v uint64) interface{} { return uint32(v) }),
-	"UInt64":   uintT(64, func(v uint64) interface{} { return v }),
-	"Float32":  floatT(32, func(v float64) interface{} { return float32(v) }),
-	"Float64":  floatT(64, func(v float64) interface{} { return v }),
+	"Date":    date,
+	"Int8":    intT(8, func(v int64) interface{} { return int8(v) }),
+	"Int16":   intT(16, func(v int64) interface{} { return int16(v) }),
+	"Int32":   intT(32, func(v int64) interface{} { return int32(v) }),
+	"Int64":   intT(64, func(v int64) interface{} { return int64(v) }),
+	"UInt8":   uintT(8, func(v uint64) interface{} { return uint8(v) }),
+	"UInt16":  uintT(16, func(v uint64) interface{} { return uint16(v) }),
+	"UInt32":  uintT(32, func(v uint64) interface{} { return uint32(v) }),
+	"UInt64":  uintT(64, func(v uint64) interface{} { return v }),
+	"Float32": floatT(32, func(v float64) interface{} { return float32(v) }),
+	"Float64": floatT(64, func(v float64) interface{} { return v }),
 }
 
 func date(str string) (interface{}, error) {
@@ -91,12 +202,15 @@ func date(str string) (interface{}, error) {
 	return value, nil
 }
 
-func dateTime(str string) (interface{}, error) {
-	value, err := time.Parse("2006-01-02 15:04:05", str)
-	if err != nil {
-		return nil, err
+// dateTime parses DateTime values in the location, the server time zone the driver reads them in.
+func dateTime(location *time.Location) converter {
+	return func(str string) (interface{}, error) {
+		value, err := time.ParseInLocation("2006-01-02 15:04:05", str, location)
+		if err != nil {
+			return nil, err
+		}
+		return value.Add(time.Nanosecond), nil
 	}
-	return value.Add(time.Nanosecond), nil
 }
 
 // Int <T>
@@ -133,15 +247,26 @@ func floatT(bitSize int, cast func(float64) interface{}) converter {
 }
 
 // Array <T>
-func arrayT(convert converter) converter {
+// The elements are separated like the ClickHouse array literals, quoted elements may contain
+// commas and escaped quotes. Empty arrays get the slice type of the column type, nil if unknown.
+func arrayT(convert converter, sliceType reflect.Type) converter {
 	return func(src string) (v interface{}, err error) {
+		if len(src) < 2 || src[0] != '[' || src[len(src)-1] != ']' {
+			return nil, fmt.Errorf("invalid array '%s'", src)
+		}
+		if len(strings.TrimSpace(src[1:len(src)-1])) == 0 {
+			if sliceType == nil {
+				return nil, fmt.Errorf("unsupported empty array '%s'", src)
+			}
+			return reflect.MakeSlice(sliceType, 0, 0).Interface(), nil
+		}
 		var (
 			slice  reflect.Value
-			values = strings.Split(src[1:len(src)-1], ",")
+			values = splitList(src[1 : len(src)-1])
 		)
 		for _, value := range values {
-			if value[0] == '\'' && value[len(value)-1] == '\'' {
-				value = value[1 : len(value)-1]
+			if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = unescapeQuoted.Replace(value[1 : len(value)-1])
 			}
 			switch v, err = convert(value); {
 			case err != nil:
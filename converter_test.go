@@ -20,6 +20,36 @@ func TestConverterFactory(t *testing.T) {
 			src:      `['A','B','C']`,
 			expected: []string{"A", "B", "C"},
 		},
+		{
+			chType:   "Array(String)",
+			src:      `['a,b','it\'s','back\\slash']`,
+			expected: []string{"a,b", "it's", `back\slash`},
+		},
+		{
+			chType:   "Array(UInt8)",
+			src:      `[]`,
+			expected: []uint8{},
+		},
+		{
+			chType:   "Nullable(Int32)",
+			src:      `\N`,
+			expected: nil,
+		},
+		{
+			chType:   "Nullable(Int32)",
+			src:      `-1`,
+			expected: int32(-1),
+		},
+		{
+			chType:   "LowCardinality(String)",
+			src:      `a`,
+			expected: "a",
+		},
+		{
+			chType:   "Decimal(9, 2)",
+			src:      `-12.5`,
+			expected: -12.5,
+		},
 		{
 			chType:   "Array(Int8)",
 			src:      `[1,2,3]`,
@@ -72,7 +102,7 @@ func TestConverterFactory(t *testing.T) {
 		},
 	}
 	for _, asset := range assets {
-		if converter, err := converterFactory(asset.chType); assert.NoError(t, err) {
+		if converter, err := converterFactory(asset.chType, time.UTC); assert.NoError(t, err) {
 			if value, err := converter(asset.src); assert.NoError(t, err) {
 				assert.Equal(t, asset.expected, value)
 			}
@@ -80,6 +110,30 @@ func TestConverterFactory(t *testing.T) {
 	}
 }
 
+func TestDateTimeConverterLocation(t *testing.T) {
+	// the fixtures hold the wall clock of the server time zone, like the text the server parses and prints
+	location := time.FixedZone("UTC-5", -5*60*60)
+	for _, chType := range []string{"DateTime", "Nullable(DateTime)", "DateTime('UTC')", "LowCardinality(DateTime)"} {
+		if converter, err := converterFactory(chType, location); assert.NoError(t, err) {
+			if value, err := converter("2019-02-09 23:30:00"); assert.NoError(t, err) && assert.IsType(t, time.Time{}, value) {
+				assert.Equal(t, time.Date(2019, 2, 10, 4, 30, 0, 0, time.UTC).Unix(), value.(time.Time).Unix(), chType)
+				assert.Equal(t, location, value.(time.Time).Location(), chType)
+			}
+		}
+	}
+	if converter, err := converterFactory("Array(DateTime)", location); assert.NoError(t, err) {
+		if value, err := converter("['2019-02-09 23:30:00']"); assert.NoError(t, err) && assert.IsType(t, []time.Time{}, value) {
+			assert.Equal(t, time.Date(2019, 2, 10, 4, 30, 0, 0, time.UTC).Unix(), value.([]time.Time)[0].Unix())
+		}
+	}
+	// Date values are days, the location does not move them
+	if converter, err := converterFactory("Date", location); assert.NoError(t, err) {
+		if value, err := converter("2019-02-09"); assert.NoError(t, err) {
+			assert.Equal(t, "2019-02-09", value.(time.Time).Format("2006-01-02"))
+		}
+	}
+}
+
 func TestTSVtoArgs(t *testing.T) {
 	var (
 		body = bytes.NewBuffer([]byte{})
@@ -89,6 +143,7 @@ func TestTSVtoArgs(t *testing.T) {
 	tsv.Write([]string{"1.1", "2.2", "1", "2", "3", "4", "10", "20", "30", "40", "Str", "00000000-0000-0000-0000-000000000000", "2019-02-09", "2019-02-09 10:10:10"})
 	tsv.Write([]string{"10.10", "20.20", "10", "20", "30", "40", "100", "200", "300", "400", "Str 2", "00000000-0000-0000-0000-000000000000", "2019-02-09", "2019-02-09 10:10:10"})
 	tsv.Flush()
+	location := time.FixedZone("UTC+3", 3*60*60)
 	if rows, err := csvToArgs([]string{
 		"Float32",
 		"Float64",
@@ -104,7 +159,7 @@ func TestTSVtoArgs(t *testing.T) {
 		"UUID",
 		"Date",
 		"DateTime",
-	}, body, '\t'); assert.NoError(t, err) {
+	}, body, '\t', location); assert.NoError(t, err) {
 		if assert.Len(t, rows, 2) {
 			{
 				assert.Equal(t, float32(1.1), rows[0][0])
@@ -130,7 +185,32 @@ func TestTSVtoArgs(t *testing.T) {
 			}
 			if tm, ok := rows[0][13].(time.Time); assert.True(t, ok) {
 				assert.Equal(t, "2019-02-09 10:10:10", tm.Format("2006-01-02 15:04:05"))
+				assert.Equal(t, int64(1549696210), tm.Unix(), "parsed in the location")
 			}
 		}
 	}
 }
+
+func TestJSONtoArgs(t *testing.T) {
+	src := `{"event_time": "2019-02-09 10:10:10", "user_id": 42, "value": 1.5, "tags": ["a", "b"], "active": true, "referrer": "google"}
+{"event_time": "2019-02-09 10:10:11", "user_id": 43, "value": 2, "tags": [], "active": false, "referrer": null, "ignored": "x"}
+{"event_time": "2019-02-09 10:10:12", "user_id": 44, "value": 3, "tags": ["it's", "back\\slash"], "active": true, "referrer": null}
+`
+	var (
+		columns = []string{"user_id", "value", "tags", "active", "referrer"}
+		types   = []string{"UInt64", "Float64", "Array(String)", "UInt8", "Nullable(String)"}
+	)
+	if rows, err := jsonToArgs(columns, types, bytes.NewBufferString(src), time.UTC); assert.NoError(t, err) {
+		assert.Equal(t, [][]interface{}{
+			{uint64(42), 1.5, []string{"a", "b"}, uint8(1), "google"},
+			{uint64(43), 2.0, []string{}, uint8(0), nil},
+			{uint64(44), 3.0, []string{"it's", `back\slash`}, uint8(1), nil},
+		}, rows)
+	}
+	if _, err := jsonToArgs([]string{"missing"}, []string{"String"}, bytes.NewBufferString(src), time.UTC); assert.Error(t, err) {
+		assert.Equal(t, "row 1: column 'missing' is missing", err.Error())
+	}
+	if _, err := jsonToArgs([]string{"user_id"}, []string{"UInt64"}, bytes.NewBufferString(`{"user_id": null}`), time.UTC); assert.Error(t, err) {
+		assert.Equal(t, "row 1: column 'user_id': null values are only supported for Nullable columns", err.Error())
+	}
+}
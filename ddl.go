@@ -0,0 +1,770 @@
+package ok
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CreateTable is a CREATE TABLE statement parsed without a server.
+// Expressions are kept as written, with whitespace collapsed.
+type CreateTable struct {
+	Database    string
+	Name        string
+	Temporary   bool
+	IfNotExists bool
+	Cluster     string
+	As          string
+	Columns     []Column
+	Indexes     []Index
+	Constraints []Constraint
+	Projections []Projection
+	Engine      *Engine
+	PartitionBy string
+	OrderBy     string
+	PrimaryKey  string
+	SampleBy    string
+	TTL         string
+	Settings    []Setting
+	Comment     string
+	AsSelect    string
+}
+
+type Column struct {
+	Name              string
+	Type              string
+	DefaultKind       string
+	DefaultExpression string
+	Codec             string
+	TTL               string
+	Comment           string
+}
+
+type Index struct {
+	Name        string
+	Expression  string
+	Type        string
+	Granularity string
+}
+
+type Constraint struct {
+	Name       string
+	Kind       string
+	Expression string
+}
+
+type Projection struct {
+	Name  string
+	Query string
+}
+
+type Engine struct {
+	Name string
+	Args []string
+}
+
+type Setting struct {
+	Name  string
+	Value string
+}
+
+func (e *Engine) String() string {
+	if e.Args == nil {
+		return e.Name
+	}
+	return e.Name + "(" + strings.Join(e.Args, ", ") + ")"
+}
+
+// Column returns the column with the given name.
+func (t *CreateTable) Column(name string) (Column, bool) {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+func (t *CreateTable) String() string {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if t.Temporary {
+		b.WriteString("TEMPORARY ")
+	}
+	b.WriteString("TABLE ")
+	if t.IfNotExists {
+		b.WriteString("IF NOT EXISTS ")
+	}
+	if len(t.Database) != 0 {
+		b.WriteString(quoteIdentifier(t.Database) + ".")
+	}
+	b.WriteString(quoteIdentifier(t.Name))
+	if len(t.Cluster) != 0 {
+		b.WriteString(" ON CLUSTER " + quoteIdentifier(t.Cluster))
+	}
+	var elements []string
+	for _, column := range t.Columns {
+		element := quoteIdentifier(column.Name)
+		if len(column.Type) != 0 {
+			element += " " + column.Type
+		}
+		if len(column.DefaultKind) != 0 {
+			element += " " + column.DefaultKind
+			if len(column.DefaultExpression) != 0 {
+				element += " " + column.DefaultExpression
+			}
+		}
+		if len(column.Comment) != 0 {
+			element += " COMMENT " + quote(column.Comment)
+		}
+		if len(column.Codec) != 0 {
+			element += " CODEC(" + column.Codec + ")"
+		}
+		if len(column.TTL) != 0 {
+			element += " TTL " + column.TTL
+		}
+		elements = append(elements, element)
+	}
+	for _, index := range t.Indexes {
+		elements = append(elements, "INDEX "+quoteIdentifier(index.Name)+" "+index.Expression+" TYPE "+index.Type+" GRANULARITY "+index.Granularity)
+	}
+	for _, constraint := range t.Constraints {
+		elements = append(elements, "CONSTRAINT "+quoteIdentifier(constraint.Name)+" "+constraint.Kind+" "+constraint.Expression)
+	}
+	for _, projection := range t.Projections {
+		elements = append(elements, "PROJECTION "+quoteIdentifier(projection.Name)+" ("+projection.Query+")")
+	}
+	if len(elements) != 0 {
+		b.WriteString("\n(\n\t" + strings.Join(elements, ",\n\t") + "\n)")
+	}
+	if len(t.As) != 0 {
+		b.WriteString(" AS " + t.As)
+	}
+	if t.Engine != nil {
+		b.WriteString("\nENGINE = " + t.Engine.String())
+	}
+	for _, clause := range []struct{ keyword, value string }{
+		{"PARTITION BY", t.PartitionBy},
+		{"ORDER BY", t.OrderBy},
+		{"PRIMARY KEY", t.PrimaryKey},
+		{"SAMPLE BY", t.SampleBy},
+		{"TTL", t.TTL},
+	} {
+		if len(clause.value) != 0 {
+			b.WriteString("\n" + clause.keyword + " " + clause.value)
+		}
+	}
+	if len(t.Settings) != 0 {
+		settings := make([]string, 0, len(t.Settings))
+		for _, setting := range t.Settings {
+			settings = append(settings, setting.Name+" = "+setting.Value)
+		}
+		b.WriteString("\nSETTINGS " + strings.Join(settings, ", "))
+	}
+	if len(t.Comment) != 0 {
+		b.WriteString("\nCOMMENT " + quote(t.Comment))
+	}
+	if len(t.AsSelect) != 0 {
+		b.WriteString("\nAS " + t.AsSelect)
+	}
+	return b.String()
+}
+
+// ParseCreateTable parses a single CREATE TABLE (or ATTACH TABLE) statement.
+func ParseCreateTable(ddl string) (*CreateTable, error) {
+	tokens, err := lex(ddl)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{src: ddl, tokens: tokens}
+	table, err := p.createTable()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse CREATE TABLE: %v", err)
+	}
+	return table, nil
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) createTable() (_ *CreateTable, err error) {
+	var table CreateTable
+	if !p.acceptKeyword("CREATE") && !p.acceptKeyword("ATTACH") {
+		return nil, p.unexpected("CREATE")
+	}
+	p.acceptKeyword("OR", "REPLACE")
+	table.Temporary = p.acceptKeyword("TEMPORARY")
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	table.IfNotExists = p.acceptKeyword("IF", "NOT", "EXISTS")
+	if table.Database, table.Name, err = p.qualifiedName(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("UUID") {
+		if p.peek().kind != tokenString {
+			return nil, p.unexpected("UUID")
+		}
+		p.next()
+	}
+	if p.acceptKeyword("ON", "CLUSTER") {
+		if table.Cluster, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().is("(") {
+		if err := p.tableElements(&table); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword("AS") && !p.isSelect(1) {
+		p.next()
+		table.As = p.expression(func() bool { return p.isKeyword("ENGINE") })
+		if len(table.As) == 0 {
+			return nil, p.unexpected("table name or table function")
+		}
+	}
+	if p.acceptKeyword("ENGINE") {
+		p.accept("=")
+		if table.Engine, err = p.engine(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		switch {
+		case p.acceptKeyword("PARTITION", "BY"):
+			table.PartitionBy = p.clause()
+		case p.acceptKeyword("ORDER", "BY"):
+			table.OrderBy = p.clause()
+		case p.acceptKeyword("PRIMARY", "KEY"):
+			table.PrimaryKey = p.clause()
+		case p.acceptKeyword("SAMPLE", "BY"):
+			table.SampleBy = p.clause()
+		case p.acceptKeyword("TTL"):
+			table.TTL = p.clause()
+		case p.acceptKeyword("SETTINGS"):
+			if table.Settings, err = p.settings(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("COMMENT"):
+			if table.Comment, err = p.stringLiteral(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("AS"):
+			from := p.pos
+			for tok := p.peek(); tok.kind != tokenEOF && !tok.is(";"); tok = p.peek() {
+				p.next()
+			}
+			if table.AsSelect = p.text(from, p.pos); len(table.AsSelect) == 0 {
+				return nil, p.unexpected("SELECT")
+			}
+		default:
+			p.accept(";")
+			if tok := p.peek(); tok.kind != tokenEOF {
+				return nil, p.unexpected("end of statement")
+			}
+			return &table, nil
+		}
+	}
+}
+
+func (p *parser) tableElements(table *CreateTable) (err error) {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for {
+		switch {
+		case p.acceptKeyword("INDEX"):
+			var index Index
+			if index.Name, err = p.name(); err != nil {
+				return err
+			}
+			index.Expression = p.expression(func() bool { return p.isKeyword("TYPE") })
+			if err := p.expectKeyword("TYPE"); err != nil {
+				return err
+			}
+			index.Type = p.expression(func() bool { return p.isKeyword("GRANULARITY") })
+			if p.acceptKeyword("GRANULARITY") {
+				index.Granularity = p.expression(nil)
+			}
+			table.Indexes = append(table.Indexes, index)
+		case p.acceptKeyword("CONSTRAINT"):
+			var constraint Constraint
+			if constraint.Name, err = p.name(); err != nil {
+				return err
+			}
+			switch {
+			case p.acceptKeyword("CHECK"):
+				constraint.Kind = "CHECK"
+			case p.acceptKeyword("ASSUME"):
+				constraint.Kind = "ASSUME"
+			default:
+				return p.unexpected("CHECK")
+			}
+			constraint.Expression = p.expression(nil)
+			table.Constraints = append(table.Constraints, constraint)
+		case p.acceptKeyword("PROJECTION"):
+			var projection Projection
+			if projection.Name, err = p.name(); err != nil {
+				return err
+			}
+			if projection.Query, err = p.parenthesized(); err != nil {
+				return err
+			}
+			table.Projections = append(table.Projections, projection)
+		case p.acceptKeyword("PRIMARY", "KEY"):
+			table.PrimaryKey = p.expression(nil)
+		default:
+			column, err := p.column()
+			if err != nil {
+				return err
+			}
+			table.Columns = append(table.Columns, column)
+		}
+		if !p.accept(",") {
+			return p.expect(")")
+		}
+	}
+}
+
+var columnModifiers = []string{"DEFAULT", "MATERIALIZED", "ALIAS", "EPHEMERAL", "COMMENT", "CODEC", "TTL"}
+
+func (p *parser) column() (column Column, err error) {
+	if column.Name, err = p.name(); err != nil {
+		return column, err
+	}
+	isModifier := func() bool {
+		return p.isAnyKeyword(columnModifiers...) || p.isKeyword("NULL") || p.isKeyword("NOT", "NULL")
+	}
+	if tok := p.peek(); !isModifier() && !tok.is(",") && !tok.is(")") {
+		if column.Type, err = p.dataType(); err != nil {
+			return column, err
+		}
+	}
+	for {
+		switch {
+		case p.acceptKeyword("NOT", "NULL"):
+		case p.acceptKeyword("NULL"):
+			column.Type = "Nullable(" + column.Type + ")"
+		case p.isAnyKeyword("DEFAULT", "MATERIALIZED", "ALIAS", "EPHEMERAL"):
+			column.DefaultKind = strings.ToUpper(p.next().text)
+			column.DefaultExpression = p.expression(isModifier)
+		case p.acceptKeyword("COMMENT"):
+			if column.Comment, err = p.stringLiteral(); err != nil {
+				return column, err
+			}
+		case p.acceptKeyword("CODEC"):
+			if column.Codec, err = p.parenthesized(); err != nil {
+				return column, err
+			}
+		case p.acceptKeyword("TTL"):
+			column.TTL = p.expression(isModifier)
+		default:
+			return column, nil
+		}
+	}
+}
+
+func (p *parser) dataType() (string, error) {
+	from := p.pos
+	if tok := p.next(); tok.kind != tokenIdent && tok.kind != tokenQuotedIdent {
+		p.pos--
+		return "", p.unexpected("data type")
+	}
+	if p.peek().is("(") {
+		if _, err := p.parenthesized(); err != nil {
+			return "", err
+		}
+	}
+	return p.text(from, p.pos), nil
+}
+
+// engine parses the engine name and its arguments. Empty arguments are kept so the others keep their positions.
+func (p *parser) engine() (*Engine, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	engine := Engine{Name: name}
+	if p.accept("(") {
+		engine.Args = []string{}
+		for !p.accept(")") {
+			engine.Args = append(engine.Args, p.expression(nil))
+			if !p.accept(",") {
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+	return &engine, nil
+}
+
+func (p *parser) settings() (settings []Setting, err error) {
+	for {
+		var setting Setting
+		if setting.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if setting.Value = p.expression(p.isClause); len(setting.Value) == 0 {
+			return nil, p.unexpected("setting value")
+		}
+		if settings = append(settings, setting); !p.accept(",") {
+			return settings, nil
+		}
+	}
+}
+
+func (p *parser) isClause() bool {
+	return p.isKeyword("PARTITION", "BY") ||
+		p.isKeyword("ORDER", "BY") ||
+		p.isKeyword("PRIMARY", "KEY") ||
+		p.isKeyword("SAMPLE", "BY") ||
+		p.isKeyword("TTL") ||
+		p.isKeyword("SETTINGS") ||
+		p.isKeyword("COMMENT") ||
+		p.isKeyword("AS")
+}
+
+func (p *parser) isSelect(offset int) bool {
+	if p.pos+offset >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.pos+offset]
+	return tok.is("(") || tok.isKeyword("SELECT") || tok.isKeyword("WITH")
+}
+
+// clause consumes a comma separated list of expressions up to the next table clause.
+func (p *parser) clause() string {
+	expressions := []string{p.expression(p.isClause)}
+	for p.accept(",") {
+		expressions = append(expressions, p.expression(p.isClause))
+	}
+	return strings.Join(expressions, ", ")
+}
+
+// expression consumes tokens up to a top-level comma, closing parenthesis,
+// semicolon or a position where stop reports true, and returns their text.
+func (p *parser) expression(stop func() bool) string {
+	var (
+		from  = p.pos
+		depth int
+	)
+	for tok := p.peek(); tok.kind != tokenEOF; tok = p.peek() {
+		if depth == 0 {
+			if tok.is(",") || tok.is(")") || tok.is(";") || (stop != nil && p.pos != from && stop()) {
+				break
+			}
+		}
+		switch {
+		case tok.is("(") || tok.is("["):
+			depth++
+		case tok.is(")") || tok.is("]"):
+			depth--
+		}
+		p.next()
+	}
+	return p.text(from, p.pos)
+}
+
+// parenthesized consumes a balanced parenthesized group and returns its inner text.
+func (p *parser) parenthesized() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	var (
+		from  = p.pos
+		depth = 1
+	)
+	for {
+		switch tok := p.next(); {
+		case tok.kind == tokenEOF:
+			return "", p.unexpected(")")
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			if depth--; depth == 0 {
+				return p.text(from, p.pos-1), nil
+			}
+		}
+	}
+}
+
+func (p *parser) qualifiedName() (database, name string, err error) {
+	if name, err = p.name(); err != nil {
+		return "", "", err
+	}
+	if p.accept(".") {
+		database = name
+		if name, err = p.name(); err != nil {
+			return "", "", err
+		}
+	}
+	return database, name, nil
+}
+
+func (p *parser) name() (string, error) {
+	switch tok := p.peek(); tok.kind {
+	case tokenIdent, tokenQuotedIdent, tokenString:
+		p.next()
+		return tok.value(), nil
+	}
+	return "", p.unexpected("identifier")
+}
+
+func (p *parser) stringLiteral() (string, error) {
+	if tok := p.peek(); tok.kind == tokenString {
+		p.next()
+		return tok.value(), nil
+	}
+	return "", p.unexpected("string literal")
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: tokenEOF, pos: len(p.src), end: len(p.src)}
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword reports whether the next tokens are the given sequence of keywords, e.g. ORDER BY.
+func (p *parser) isKeyword(words ...string) bool {
+	for i, word := range words {
+		if p.pos+i >= len(p.tokens) || !p.tokens[p.pos+i].isKeyword(word) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAnyKeyword reports whether the next token is one of the given keywords.
+func (p *parser) isAnyKeyword(words ...string) bool {
+	for _, word := range words {
+		if p.peek().isKeyword(word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(words ...string) bool {
+	if p.isKeyword(words...) {
+		p.pos += len(words)
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(words ...string) error {
+	if !p.acceptKeyword(words...) {
+		return p.unexpected(strings.Join(words, " "))
+	}
+	return nil
+}
+
+func (p *parser) accept(punct string) bool {
+	if p.peek().is(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.accept(punct) {
+		return p.unexpected("'" + punct + "'")
+	}
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return fmt.Errorf("expected %s at offset %d, got '%s'", expected, tok.pos, tok.text)
+	}
+	return fmt.Errorf("expected %s, got end of statement", expected)
+}
+
+// text returns the source of tokens [from, to) with whitespace and comments between them collapsed to a single space.
+func (p *parser) text(from, to int) string {
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		if i != from && p.tokens[i].pos != p.tokens[i-1].end {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.tokens[i].text)
+	}
+	return b.String()
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	end  int
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokenPunct && t.text == punct
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+// value returns the unquoted value of identifiers and string literals.
+func (t token) value() string {
+	switch t.kind {
+	case tokenQuotedIdent, tokenString:
+		var (
+			b     strings.Builder
+			quote = t.text[0]
+			text  = t.text[1 : len(t.text)-1]
+		)
+		for i := 0; i < len(text); i++ {
+			switch {
+			case text[i] == '\\' && i+1 < len(text):
+				i++
+				b.WriteByte(unescape(text[i]))
+			case text[i] == quote && i+1 < len(text) && text[i+1] == quote:
+				i++
+				b.WriteByte(quote)
+			default:
+				b.WriteByte(text[i])
+			}
+		}
+		return b.String()
+	}
+	return t.text
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	}
+	return c
+}
+
+var operators = []string{"->", "<=", ">=", "!=", "<>", "==", "||", "::"}
+
+func lex(src string) (tokens []token, _ error) {
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			if end := strings.IndexByte(src[i:], '\n'); end != -1 {
+				i += end + 1
+			} else {
+				i = len(src)
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			end, err := quoted(src, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenQuotedIdent
+			if c == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, token{kind: kind, text: src[i:end], pos: i, end: end})
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(src) && (isIdentStart(src[end]) || isDigit(src[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[i:end], pos: i, end: end})
+			i = end
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			end := number.FindStringIndex(src[i:])[1] + i
+			tokens = append(tokens, token{kind: tokenNumber, text: src[i:end], pos: i, end: end})
+			i = end
+		default:
+			end := i + 1
+			for _, operator := range operators {
+				if strings.HasPrefix(src[i:], operator) {
+					end = i + len(operator)
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: src[i:end], pos: i, end: end})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+var number = regexp.MustCompile(`^(?:0[xX][0-9a-fA-F]+|[0-9]*\.?[0-9]+(?:[eE][+-]?[0-9]+)?|[0-9]+\.)`)
+
+func quoted(src string, start int) (int, error) {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(src) && src[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted string at offset %d", start)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+var bareIdentifier = regexp.MustCompile(`^[a-zA-Z_][0-9a-zA-Z_]*$`)
+
+func quoteIdentifier(name string) string {
+	if bareIdentifier.MatchString(name) {
+		return name
+	}
+	return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(name) + "`"
+}
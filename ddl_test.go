@@ -0,0 +1,111 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	const ddl = `
+	CREATE TABLE IF NOT EXISTS db.events ON CLUSTER '{cluster}' (
+		event_date   Date DEFAULT toDate(event_time)
+		, event_time DateTime('UTC') CODEC(Delta(4), LZ4)
+		, event_type LowCardinality(String) COMMENT 'view, click'
+		, user_id    UInt64
+		, value      Nullable(Float64) TTL event_date + INTERVAL 1 MONTH
+		, tags       Nested(key String, value String)
+		, -- trailing comment
+		  ` + "`user name`" + ` String ALIAS concat('u', toString(user_id))
+		, INDEX idx_type event_type TYPE set(100) GRANULARITY 4
+		, CONSTRAINT positive CHECK user_id > 0
+	) Engine = ReplicatedMergeTree('/clickhouse/tables/{shard}/events', '{replica}')
+	PARTITION BY toYYYYMM(event_date)
+	ORDER BY (event_date, user_id, intHash32(user_id))
+	SAMPLE BY intHash32(user_id)
+	TTL event_date + INTERVAL 1 YEAR DELETE, event_date + INTERVAL 1 MONTH TO VOLUME 'cold'
+	SETTINGS index_granularity = 8192, storage_policy = 'tiered';
+	`
+	table, err := ParseCreateTable(ddl)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Equal(t, "db", table.Database) && assert.Equal(t, "events", table.Name) {
+		assert.True(t, table.IfNotExists)
+		assert.Equal(t, "{cluster}", table.Cluster)
+	}
+	if assert.Len(t, table.Columns, 7) {
+		assert.Equal(t, Column{Name: "event_date", Type: "Date", DefaultKind: "DEFAULT", DefaultExpression: "toDate(event_time)"}, table.Columns[0])
+		assert.Equal(t, Column{Name: "event_time", Type: "DateTime('UTC')", Codec: "Delta(4), LZ4"}, table.Columns[1])
+		assert.Equal(t, Column{Name: "event_type", Type: "LowCardinality(String)", Comment: "view, click"}, table.Columns[2])
+		assert.Equal(t, Column{Name: "value", Type: "Nullable(Float64)", TTL: "event_date + INTERVAL 1 MONTH"}, table.Columns[4])
+		assert.Equal(t, Column{Name: "tags", Type: "Nested(key String, value String)"}, table.Columns[5])
+		assert.Equal(t, Column{Name: "user name", Type: "String", DefaultKind: "ALIAS", DefaultExpression: "concat('u', toString(user_id))"}, table.Columns[6])
+	}
+	if assert.Len(t, table.Indexes, 1) {
+		assert.Equal(t, Index{Name: "idx_type", Expression: "event_type", Type: "set(100)", Granularity: "4"}, table.Indexes[0])
+	}
+	if assert.Len(t, table.Constraints, 1) {
+		assert.Equal(t, Constraint{Name: "positive", Kind: "CHECK", Expression: "user_id > 0"}, table.Constraints[0])
+	}
+	if assert.NotNil(t, table.Engine) {
+		assert.Equal(t, "ReplicatedMergeTree", table.Engine.Name)
+		assert.Equal(t, []string{"'/clickhouse/tables/{shard}/events'", "'{replica}'"}, table.Engine.Args)
+	}
+	assert.Equal(t, "toYYYYMM(event_date)", table.PartitionBy)
+	assert.Equal(t, "(event_date, user_id, intHash32(user_id))", table.OrderBy)
+	assert.Equal(t, "intHash32(user_id)", table.SampleBy)
+	assert.Equal(t, "event_date + INTERVAL 1 YEAR DELETE, event_date + INTERVAL 1 MONTH TO VOLUME 'cold'", table.TTL)
+	assert.Equal(t, []Setting{{"index_granularity", "8192"}, {"storage_policy", "'tiered'"}}, table.Settings)
+
+	if reparsed, err := ParseCreateTable(table.String()); assert.NoError(t, err) {
+		assert.Equal(t, table, reparsed)
+	}
+}
+
+func TestParseCreateTableForms(t *testing.T) {
+	assets := map[string]CreateTable{
+		"CREATE TABLE t (a UInt8) Engine Memory": {
+			Name:    "t",
+			Columns: []Column{{Name: "a", Type: "UInt8"}},
+			Engine:  &Engine{Name: "Memory"},
+		},
+		"create temporary table t (a UInt8, b String)": {
+			Name:      "t",
+			Temporary: true,
+			Columns:   []Column{{Name: "a", Type: "UInt8"}, {Name: "b", Type: "String"}},
+		},
+		"CREATE TABLE db.t AS db.local ENGINE = Distributed(cluster, db, local, rand())": {
+			Database: "db",
+			Name:     "t",
+			As:       "db.local",
+			Engine:   &Engine{Name: "Distributed", Args: []string{"cluster", "db", "local", "rand()"}},
+		},
+		"CREATE TABLE t ENGINE = MergeTree() ORDER BY tuple() AS SELECT number FROM system.numbers LIMIT 10;": {
+			Name:     "t",
+			Engine:   &Engine{Name: "MergeTree", Args: []string{}},
+			OrderBy:  "tuple()",
+			AsSelect: "SELECT number FROM system.numbers LIMIT 10",
+		},
+		"CREATE TABLE t (a UInt8 NULL, b UInt8 NOT NULL, c DEFAULT 1) ENGINE = Log COMMENT 'it''s'": {
+			Name:    "t",
+			Columns: []Column{{Name: "a", Type: "Nullable(UInt8)"}, {Name: "b", Type: "UInt8"}, {Name: "c", DefaultKind: "DEFAULT", DefaultExpression: "1"}},
+			Engine:  &Engine{Name: "Log"},
+			Comment: "it's",
+		},
+	}
+	for src, expected := range assets {
+		if table, err := ParseCreateTable(src); assert.NoError(t, err, src) {
+			assert.Equal(t, &expected, table, src)
+		}
+	}
+	for _, src := range []string{
+		"CREATE DATABASE db",
+		"CREATE TABLE t (a UInt8",
+		"CREATE TABLE t (a UInt8) ENGINE = Memory garbage",
+		"CREATE TABLE t (a String DEFAULT 'unterminated)",
+	} {
+		_, err := ParseCreateTable(src)
+		assert.Error(t, err, src)
+	}
+}
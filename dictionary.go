@@ -0,0 +1,220 @@
+package ok
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DictionaryFixture describes a DDL dictionary reading its data from a fixture table.
+// The dictionary structure is taken from the columns of the table.
+type DictionaryFixture struct {
+	// Name of the dictionary, "database.dictionary" or "dictionary" for the connection database.
+	Name string
+	// Table the dictionary reads, "database.table" or "table" for the connection database.
+	Table string
+	// PrimaryKey columns, the first column of the table by default.
+	PrimaryKey []string
+	// Layout such as "flat", "hashed" or "cache(SIZE_IN_CELLS 1000)". By default it is HASHED for a
+	// single UInt64 key, COMPLEX_KEY_HASHED for other keys and RANGE_HASHED when a range is set.
+	Layout string
+	// RangeMin and RangeMax columns of the validity range for RANGE_HASHED layouts.
+	RangeMin string
+	RangeMax string
+}
+
+// dictionaryKey remembers how to build the key argument of dictGet for a fixture dictionary.
+type dictionaryKey struct {
+	types   []string
+	complex bool
+	ranged  bool
+}
+
+// CreateDictionary creates the fixture dictionary and waits until it is loaded.
+func (c *clickhouse) CreateDictionary(fixture DictionaryFixture) bool {
+	database, table := c.splitName(fixture.Table)
+	schema, err := c.TableSchema(database, table)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	ddl, key, err := dictionaryDDL(fixture, c.qualify(fixture.Name), database, table, schema.Columns)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	if err := c.Exec(ddl); err != nil {
+		c.test.Errorf("an error occurred while creating the dictionary: %v", err)
+		return false
+	}
+	if c.dictionaries == nil {
+		c.dictionaries = make(map[string]dictionaryKey)
+	}
+	c.dictionaries[c.qualify(fixture.Name)] = key
+	return c.ReloadDictionary(c.qualify(fixture.Name))
+}
+
+// CreateDictionaryFromCSVFile loads the CSV file into the fixture table and creates the dictionary.
+func (c *clickhouse) CreateDictionaryFromCSVFile(fixture DictionaryFixture, path string) bool {
+	return c.CopyFromCSVFile(path, "INSERT INTO "+c.qualify(fixture.Table)+" VALUES") && c.CreateDictionary(fixture)
+}
+
+// CreateDictionaryFromTSVFile loads the TSV file into the fixture table and creates the dictionary.
+func (c *clickhouse) CreateDictionaryFromTSVFile(fixture DictionaryFixture, path string) bool {
+	return c.CopyFromTSVFile(path, "INSERT INTO "+c.qualify(fixture.Table)+" VALUES") && c.CreateDictionary(fixture)
+}
+
+func (c *clickhouse) DropDictionary(database, dictionary string) bool {
+	if err := c.Exec("DROP DICTIONARY IF EXISTS " + database + "." + dictionary); err != nil {
+		c.test.Errorf("an error occurred while deleting the dictionary: %v", err)
+		return false
+	}
+	delete(c.dictionaries, database+"."+dictionary)
+	return true
+}
+
+// AssertDictGet checks the value dictGet returns for the attribute and key.
+// Composite keys are passed as a slice of their values; for range dictionaries
+// the key is a slice of the id and the point in the range.
+func (c *clickhouse) AssertDictGet(dictionary, attribute string, key, expected interface{}) bool {
+	name := dictionary
+	if !strings.Contains(name, ".") {
+		if _, found := c.dictionaries[c.qualify(name)]; found {
+			name = c.qualify(name)
+		}
+	}
+	expr, args := dictionaryKeyExpr(c.dictionaries[name], key)
+	var (
+		query  = "SELECT dictGet(?, ?, " + expr + ")"
+		actual = newScanTarget(expected)
+	)
+	if err := c.conn.QueryRow(query, append([]interface{}{name, attribute}, args...)...).Scan(actual.Interface()); err != nil {
+		c.test.Errorf("an error occurred while getting '%s' of %v from dictionary '%s': %v", attribute, key, dictionary, err)
+		return false
+	}
+	if !reflect.DeepEqual(expected, actual.Elem().Interface()) {
+		c.test.Errorf("dictionary '%s': '%s' of %v: expected %v, got %v", dictionary, attribute, key, expected, actual.Elem().Interface())
+		return false
+	}
+	return true
+}
+
+// qualify adds the connection database to names without one.
+func (c *clickhouse) qualify(name string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	return c.database + "." + name
+}
+
+func (c *clickhouse) splitName(name string) (string, string) {
+	parts := strings.SplitN(c.qualify(name), ".", 2)
+	return parts[0], parts[1]
+}
+
+func dictionaryDDL(fixture DictionaryFixture, name, database, table string, columns []ColumnSchema) (string, dictionaryKey, error) {
+	var key dictionaryKey
+	if len(columns) == 0 {
+		return "", key, fmt.Errorf("table '%s.%s' has no columns", database, table)
+	}
+	primaryKey := fixture.PrimaryKey
+	if len(primaryKey) == 0 {
+		primaryKey = []string{columns[0].Name}
+	}
+	types := make(map[string]string, len(columns))
+	for _, column := range columns {
+		types[column.Name] = column.Type
+	}
+	for _, column := range append(append([]string(nil), primaryKey...), fixture.RangeMin, fixture.RangeMax) {
+		if _, found := types[column]; !found && len(column) != 0 {
+			return "", key, fmt.Errorf("table '%s.%s' has no column '%s'", database, table, column)
+		}
+	}
+	if (len(fixture.RangeMin) == 0) != (len(fixture.RangeMax) == 0) {
+		return "", key, fmt.Errorf("dictionary '%s': both RangeMin and RangeMax have to be set", name)
+	}
+	for _, column := range primaryKey {
+		key.types = append(key.types, types[column])
+	}
+	layout := fixture.Layout
+	switch {
+	case len(layout) != 0:
+	case len(fixture.RangeMin) != 0:
+		layout = "RANGE_HASHED"
+	case len(primaryKey) == 1 && key.types[0] == "UInt64":
+		layout = "HASHED"
+	default:
+		layout = "COMPLEX_KEY_HASHED"
+	}
+	if !strings.Contains(layout, "(") {
+		layout = strings.ToUpper(layout) + "()"
+	}
+	lower := strings.ToLower(layout)
+	key.complex = strings.HasPrefix(lower, "complex_key") || strings.HasPrefix(lower, "ip_trie")
+	key.ranged = strings.Contains(lower, "range")
+	var (
+		structure = make([]string, 0, len(columns))
+		lifetime  = "LIFETIME(0)"
+	)
+	for _, column := range columns {
+		structure = append(structure, quoteIdentifier(column.Name)+" "+column.Type)
+	}
+	keys := make([]string, 0, len(primaryKey))
+	for _, column := range primaryKey {
+		keys = append(keys, quoteIdentifier(column))
+	}
+	if len(fixture.RangeMin) != 0 {
+		lifetime += " RANGE(MIN " + quoteIdentifier(fixture.RangeMin) + " MAX " + quoteIdentifier(fixture.RangeMax) + ")"
+	}
+	ddl := fmt.Sprintf("CREATE DICTIONARY %s (%s) PRIMARY KEY %s SOURCE(CLICKHOUSE(TABLE %s DB %s)) %s LAYOUT(%s)",
+		name, strings.Join(structure, ", "), strings.Join(keys, ", "), quote(table), quote(database), lifetime, layout,
+	)
+	return ddl, key, nil
+}
+
+// dictionaryKeyExpr builds the key arguments of dictGet. Keys of dictionaries
+// created from fixtures are cast to the key column types, other keys are
+// passed as UInt64 or, for composite keys, as a tuple of the values.
+func dictionaryKeyExpr(key dictionaryKey, value interface{}) (string, []interface{}) {
+	var values []interface{}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i).Interface())
+		}
+	} else {
+		values = []interface{}{value}
+	}
+	var (
+		at   string
+		keys = values
+	)
+	if key.ranged && len(values) > 1 {
+		keys, at = values[:len(values)-1], ", ?"
+	}
+	switch {
+	case len(key.types) == 0 && len(keys) == 1:
+		if _, isString := keys[0].(string); !isString {
+			return "toUInt64(?)" + at, values
+		}
+		return "tuple(?)" + at, values
+	case len(key.types) == 0:
+		return "tuple(" + strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ") + ")" + at, values
+	case !key.complex:
+		return "toUInt64(?)" + at, values
+	}
+	casts := make([]string, 0, len(key.types))
+	for _, t := range key.types {
+		casts = append(casts, "CAST(? AS "+t+")")
+	}
+	return "tuple(" + strings.Join(casts, ", ") + ")" + at, values
+}
+
+// dictionaryWhere matches the dictionary by database and name: a dictionary of the configuration,
+// which has no database, or a DDL dictionary, "database.dictionary" or of the current database.
+func dictionaryWhere(dictionary string) string {
+	where := "(database = '' AND name = " + quote(dictionary) + ")"
+	if parts := strings.SplitN(dictionary, ".", 2); len(parts) == 2 {
+		return "(" + where + " OR (database = " + quote(parts[0]) + " AND name = " + quote(parts[1]) + "))"
+	}
+	return "(" + where + " OR (database = currentDatabase() AND name = " + quote(dictionary) + "))"
+}
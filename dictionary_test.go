@@ -0,0 +1,134 @@
+package ok
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictionaryDDL(t *testing.T) {
+	columns := []ColumnSchema{
+		{Name: "id", Type: "UInt64"},
+		{Name: "code", Type: "String"},
+		{Name: "name", Type: "String"},
+		{Name: "start", Type: "Date"},
+		{Name: "end", Type: "Date"},
+	}
+	type asset struct {
+		fixture DictionaryFixture
+		ddl     string
+		key     dictionaryKey
+	}
+	assets := []asset{
+		{
+			fixture: DictionaryFixture{},
+			ddl:     "CREATE DICTIONARY db.dict (id UInt64, code String, name String, start Date, end Date) PRIMARY KEY id SOURCE(CLICKHOUSE(TABLE 'source' DB 'db')) LIFETIME(0) LAYOUT(HASHED())",
+			key:     dictionaryKey{types: []string{"UInt64"}},
+		},
+		{
+			fixture: DictionaryFixture{PrimaryKey: []string{"code"}},
+			ddl:     "CREATE DICTIONARY db.dict (id UInt64, code String, name String, start Date, end Date) PRIMARY KEY code SOURCE(CLICKHOUSE(TABLE 'source' DB 'db')) LIFETIME(0) LAYOUT(COMPLEX_KEY_HASHED())",
+			key:     dictionaryKey{types: []string{"String"}, complex: true},
+		},
+		{
+			fixture: DictionaryFixture{PrimaryKey: []string{"id", "code"}, Layout: "complex_key_cache(SIZE_IN_CELLS 10)"},
+			ddl:     "CREATE DICTIONARY db.dict (id UInt64, code String, name String, start Date, end Date) PRIMARY KEY id, code SOURCE(CLICKHOUSE(TABLE 'source' DB 'db')) LIFETIME(0) LAYOUT(complex_key_cache(SIZE_IN_CELLS 10))",
+			key:     dictionaryKey{types: []string{"UInt64", "String"}, complex: true},
+		},
+		{
+			fixture: DictionaryFixture{RangeMin: "start", RangeMax: "end"},
+			ddl:     "CREATE DICTIONARY db.dict (id UInt64, code String, name String, start Date, end Date) PRIMARY KEY id SOURCE(CLICKHOUSE(TABLE 'source' DB 'db')) LIFETIME(0) RANGE(MIN start MAX end) LAYOUT(RANGE_HASHED())",
+			key:     dictionaryKey{types: []string{"UInt64"}, ranged: true},
+		},
+	}
+	for _, asset := range assets {
+		ddl, key, err := dictionaryDDL(asset.fixture, "db.dict", "db", "source", columns)
+		if assert.NoError(t, err) {
+			assert.Equal(t, asset.ddl, ddl)
+			assert.Equal(t, asset.key, key)
+		}
+	}
+	for _, fixture := range []DictionaryFixture{
+		{PrimaryKey: []string{"missing"}},
+		{RangeMin: "start"},
+	} {
+		_, _, err := dictionaryDDL(fixture, "db.dict", "db", "source", columns)
+		assert.Error(t, err)
+	}
+}
+
+func TestDictionaryKeyExpr(t *testing.T) {
+	type asset struct {
+		key    dictionaryKey
+		value  interface{}
+		expr   string
+		values []interface{}
+	}
+	assets := []asset{
+		{value: 42, expr: "toUInt64(?)", values: []interface{}{42}},
+		{value: "ru", expr: "tuple(?)", values: []interface{}{"ru"}},
+		{value: []interface{}{1, "ru"}, expr: "tuple(?, ?)", values: []interface{}{1, "ru"}},
+		{key: dictionaryKey{types: []string{"UInt64"}}, value: 42, expr: "toUInt64(?)", values: []interface{}{42}},
+		{key: dictionaryKey{types: []string{"UInt64", "String"}, complex: true}, value: []interface{}{1, "ru"}, expr: "tuple(CAST(? AS UInt64), CAST(? AS String))", values: []interface{}{1, "ru"}},
+		{key: dictionaryKey{types: []string{"UInt64"}, ranged: true}, value: []interface{}{1, "2020-01-01"}, expr: "toUInt64(?), ?", values: []interface{}{1, "2020-01-01"}},
+	}
+	for _, asset := range assets {
+		expr, values := dictionaryKeyExpr(asset.key, asset.value)
+		assert.Equal(t, asset.expr, expr)
+		assert.Equal(t, asset.values, values)
+	}
+}
+
+func TestDictionaryFixture(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.SetWaitTimeout(10 * time.Second)
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE dictionary_tester;
+	CREATE TABLE dictionary_tester.countries (
+		id     UInt64
+		, code String
+		, name String
+	) Engine Memory;
+	CREATE TABLE dictionary_tester.prices (
+		id      UInt64
+		, start Date
+		, end   Date
+		, price Float64
+	) Engine Memory;
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	countries := DictionaryFixture{
+		Name:  "dictionary_tester.countries_by_id",
+		Table: "dictionary_tester.countries",
+	}
+	if assert.True(t, clickhouse.CreateDictionaryFromCSVFile(countries, "testdata/dictionaries/countries.csv")) {
+		assert.True(t, clickhouse.AssertDictGet("dictionary_tester.countries_by_id", "name", 2, "Germany"))
+		assert.True(t, clickhouse.AssertDictGet("dictionary_tester.countries_by_id", "code", 3, "fr"))
+	}
+	byCode := DictionaryFixture{
+		Name:       "dictionary_tester.countries_by_code",
+		Table:      "dictionary_tester.countries",
+		PrimaryKey: []string{"code"},
+	}
+	if assert.True(t, clickhouse.CreateDictionary(byCode)) {
+		assert.True(t, clickhouse.AssertDictGet("dictionary_tester.countries_by_code", "name", "ru", "Russia"))
+		assert.True(t, clickhouse.AssertDictGet("dictionary_tester.countries_by_code", "id", "de", uint64(2)))
+	}
+	if !assert.NoError(t, clickhouse.Exec("INSERT INTO dictionary_tester.prices SELECT 1, toDate('2020-01-01'), toDate('2020-12-31'), 9.99")) {
+		return
+	}
+	prices := DictionaryFixture{
+		Name:     "dictionary_tester.prices_by_date",
+		Table:    "dictionary_tester.prices",
+		RangeMin: "start",
+		RangeMax: "end",
+	}
+	if assert.True(t, clickhouse.CreateDictionary(prices)) {
+		at := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+		assert.True(t, clickhouse.AssertDictGet("dictionary_tester.prices_by_date", "price", []interface{}{1, at}, 9.99))
+	}
+}
@@ -0,0 +1,172 @@
+package ok
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	ch "github.com/kshvakov/clickhouse"
+)
+
+// ErrorCode is the code of a ClickHouse server exception.
+type ErrorCode int32
+
+const (
+	UnsupportedMethod                ErrorCode = 1
+	CannotParseText                  ErrorCode = 6
+	IncorrectNumberOfColumns         ErrorCode = 7
+	ThereIsNoColumn                  ErrorCode = 8
+	DuplicateColumn                  ErrorCode = 15
+	NoSuchColumnInTable              ErrorCode = 16
+	CannotParseInputAssertionFailed  ErrorCode = 27
+	AttemptToReadAfterEOF            ErrorCode = 32
+	CannotReadAllData                ErrorCode = 33
+	BadArguments                     ErrorCode = 36
+	CannotParseDate                  ErrorCode = 38
+	CannotParseDateTime              ErrorCode = 41
+	NumberOfArgumentsDoesntMatch     ErrorCode = 42
+	IllegalTypeOfArgument            ErrorCode = 43
+	IllegalColumn                    ErrorCode = 44
+	UnknownFunction                  ErrorCode = 46
+	UnknownIdentifier                ErrorCode = 47
+	NotImplemented                   ErrorCode = 48
+	LogicalError                     ErrorCode = 49
+	UnknownType                      ErrorCode = 50
+	TypeMismatch                     ErrorCode = 53
+	UnknownStorage                   ErrorCode = 56
+	TableAlreadyExists               ErrorCode = 57
+	UnknownTable                     ErrorCode = 60
+	SyntaxError                      ErrorCode = 62
+	UnknownAggregateFunction         ErrorCode = 63
+	ArgumentOutOfBound               ErrorCode = 69
+	CannotConvertType                ErrorCode = 70
+	CannotParseNumber                ErrorCode = 72
+	UnknownFormat                    ErrorCode = 73
+	IncorrectQuery                   ErrorCode = 80
+	UnknownDatabase                  ErrorCode = 81
+	DatabaseAlreadyExists            ErrorCode = 82
+	UnknownSetting                   ErrorCode = 115
+	IllegalDivision                  ErrorCode = 153
+	TooManyRows                      ErrorCode = 158
+	TimeoutExceeded                  ErrorCode = 159
+	Readonly                         ErrorCode = 164
+	IllegalAggregation               ErrorCode = 184
+	SizesOfArraysDoesntMatch         ErrorCode = 190
+	UnknownUser                      ErrorCode = 192
+	RequiredPassword                 ErrorCode = 194
+	TooManySimultaneousQueries       ErrorCode = 202
+	NotAnAggregate                   ErrorCode = 215
+	TableIsDropped                   ErrorCode = 218
+	MemoryLimitExceeded              ErrorCode = 241
+	TooManyParts                     ErrorCode = 252
+	IndexNotUsed                     ErrorCode = 277
+	CannotInsertNullInOrdinaryColumn ErrorCode = 349
+	QueryWasCancelled                ErrorCode = 394
+	TooManyRowsOrBytes               ErrorCode = 396
+	ViolatedConstraint               ErrorCode = 469
+	AccessDenied                     ErrorCode = 497
+	UnknownException                 ErrorCode = 1002
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	UnsupportedMethod:                "UNSUPPORTED_METHOD",
+	CannotParseText:                  "CANNOT_PARSE_TEXT",
+	IncorrectNumberOfColumns:         "INCORRECT_NUMBER_OF_COLUMNS",
+	ThereIsNoColumn:                  "THERE_IS_NO_COLUMN",
+	DuplicateColumn:                  "DUPLICATE_COLUMN",
+	NoSuchColumnInTable:              "NO_SUCH_COLUMN_IN_TABLE",
+	CannotParseInputAssertionFailed:  "CANNOT_PARSE_INPUT_ASSERTION_FAILED",
+	AttemptToReadAfterEOF:            "ATTEMPT_TO_READ_AFTER_EOF",
+	CannotReadAllData:                "CANNOT_READ_ALL_DATA",
+	BadArguments:                     "BAD_ARGUMENTS",
+	CannotParseDate:                  "CANNOT_PARSE_DATE",
+	CannotParseDateTime:              "CANNOT_PARSE_DATETIME",
+	NumberOfArgumentsDoesntMatch:     "NUMBER_OF_ARGUMENTS_DOESNT_MATCH",
+	IllegalTypeOfArgument:            "ILLEGAL_TYPE_OF_ARGUMENT",
+	IllegalColumn:                    "ILLEGAL_COLUMN",
+	UnknownFunction:                  "UNKNOWN_FUNCTION",
+	UnknownIdentifier:                "UNKNOWN_IDENTIFIER",
+	NotImplemented:                   "NOT_IMPLEMENTED",
+	LogicalError:                     "LOGICAL_ERROR",
+	UnknownType:                      "UNKNOWN_TYPE",
+	TypeMismatch:                     "TYPE_MISMATCH",
+	UnknownStorage:                   "UNKNOWN_STORAGE",
+	TableAlreadyExists:               "TABLE_ALREADY_EXISTS",
+	UnknownTable:                     "UNKNOWN_TABLE",
+	SyntaxError:                      "SYNTAX_ERROR",
+	UnknownAggregateFunction:         "UNKNOWN_AGGREGATE_FUNCTION",
+	ArgumentOutOfBound:               "ARGUMENT_OUT_OF_BOUND",
+	CannotConvertType:                "CANNOT_CONVERT_TYPE",
+	CannotParseNumber:                "CANNOT_PARSE_NUMBER",
+	UnknownFormat:                    "UNKNOWN_FORMAT",
+	IncorrectQuery:                   "INCORRECT_QUERY",
+	UnknownDatabase:                  "UNKNOWN_DATABASE",
+	DatabaseAlreadyExists:            "DATABASE_ALREADY_EXISTS",
+	UnknownSetting:                   "UNKNOWN_SETTING",
+	IllegalDivision:                  "ILLEGAL_DIVISION",
+	TooManyRows:                      "TOO_MANY_ROWS",
+	TimeoutExceeded:                  "TIMEOUT_EXCEEDED",
+	Readonly:                         "READONLY",
+	IllegalAggregation:               "ILLEGAL_AGGREGATION",
+	SizesOfArraysDoesntMatch:         "SIZES_OF_ARRAYS_DOESNT_MATCH",
+	UnknownUser:                      "UNKNOWN_USER",
+	RequiredPassword:                 "REQUIRED_PASSWORD",
+	TooManySimultaneousQueries:       "TOO_MANY_SIMULTANEOUS_QUERIES",
+	NotAnAggregate:                   "NOT_AN_AGGREGATE",
+	TableIsDropped:                   "TABLE_IS_DROPPED",
+	MemoryLimitExceeded:              "MEMORY_LIMIT_EXCEEDED",
+	TooManyParts:                     "TOO_MANY_PARTS",
+	IndexNotUsed:                     "INDEX_NOT_USED",
+	CannotInsertNullInOrdinaryColumn: "CANNOT_INSERT_NULL_IN_ORDINARY_COLUMN",
+	QueryWasCancelled:                "QUERY_WAS_CANCELLED",
+	TooManyRowsOrBytes:               "TOO_MANY_ROWS_OR_BYTES",
+	ViolatedConstraint:               "VIOLATED_CONSTRAINT",
+	AccessDenied:                     "ACCESS_DENIED",
+	UnknownException:                 "UNKNOWN_EXCEPTION",
+}
+
+func (code ErrorCode) String() string {
+	if name, found := errorCodeNames[code]; found {
+		return fmt.Sprintf("%s (%d)", name, int32(code))
+	}
+	return fmt.Sprintf("code %d", int32(code))
+}
+
+// exceptionCode matches the code of exceptions that were wrapped into other errors.
+var exceptionCode = regexp.MustCompile(`code: (\d+), message: `)
+
+// errorCode returns the code of the ClickHouse exception behind the error.
+func errorCode(err error) (ErrorCode, bool) {
+	if exception, ok := err.(*ch.Exception); ok {
+		return ErrorCode(exception.Code), true
+	}
+	if match := exceptionCode.FindStringSubmatch(err.Error()); match != nil {
+		if code, err := strconv.ParseInt(match[1], 10, 32); err == nil {
+			return ErrorCode(code), true
+		}
+	}
+	return 0, false
+}
+
+// AssertErrorCode checks that the error is a ClickHouse exception with the code.
+func (c *clickhouse) AssertErrorCode(err error, code ErrorCode) bool {
+	if err == nil {
+		c.test.Errorf("expected exception %s, got no error", code)
+		return false
+	}
+	actual, ok := errorCode(err)
+	switch {
+	case !ok:
+		c.test.Errorf("expected exception %s, got: %v", code, err)
+		return false
+	case actual != code:
+		c.test.Errorf("expected exception %s, got %s: %v", code, actual, err)
+		return false
+	}
+	return true
+}
+
+// ExpectExecError runs the query with Exec and checks that it fails with the code.
+func (c *clickhouse) ExpectExecError(query string, code ErrorCode) bool {
+	return c.AssertErrorCode(c.Exec(query), code)
+}
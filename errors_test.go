@@ -0,0 +1,44 @@
+package ok
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	ch "github.com/kshvakov/clickhouse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	type asset struct {
+		err  error
+		code ErrorCode
+		ok   bool
+	}
+	exception := &ch.Exception{Code: 60, Name: "DB::Exception", Message: "Table default.missing doesn't exist."}
+	assets := []asset{
+		{err: exception, code: UnknownTable, ok: true},
+		{err: fmt.Errorf("SET max_memory_usage = 1: %v", &ch.Exception{Code: 241}), code: MemoryLimitExceeded, ok: true},
+		{err: errors.New("connection refused")},
+	}
+	for _, asset := range assets {
+		code, ok := errorCode(asset.err)
+		if assert.Equal(t, asset.ok, ok, asset.err.Error()) {
+			assert.Equal(t, asset.code, code)
+		}
+	}
+	assert.Equal(t, "UNKNOWN_TABLE (60)", UnknownTable.String())
+	assert.Equal(t, "code 100500", ErrorCode(100500).String())
+}
+
+func TestExpectExecError(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	assert.True(t, clickhouse.ExpectExecError("SELECT * FROM ok_errors_tester.missing", UnknownDatabase))
+	assert.True(t, clickhouse.ExpectExecError("SELECT * FROM system.missing", UnknownTable))
+	assert.True(t, clickhouse.ExpectExecError("SELECT unknownFunction()", UnknownFunction))
+	assert.True(t, clickhouse.ExpectExecError("SELEC 1", SyntaxError))
+	if err := clickhouse.Exec("CREATE DATABASE errors_tester"); assert.NoError(t, err) {
+		assert.True(t, clickhouse.AssertErrorCode(clickhouse.Exec("CREATE DATABASE errors_tester"), DatabaseAlreadyExists))
+	}
+}
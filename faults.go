@@ -0,0 +1,196 @@
+package ok
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+
+	"github.com/kshvakov/clickhouse/lib/binary"
+	"github.com/kshvakov/clickhouse/lib/protocol"
+)
+
+// Fault is a fault the proxy injects into the packets clients send through it. Faults apply
+// to all packets unless limited to the queries matching a pattern with ForQuery, and fire every
+// time unless limited with Times, e.g. to let the retry of a query succeed:
+//
+//	proxy.SetFaults(
+//		ok.ReturnException(ok.TooManySimultaneousQueries, "Too many simultaneous queries").ForQuery(`^SELECT`).Times(2),
+//		ok.AddLatency(50 * time.Millisecond),
+//	)
+type Fault struct {
+	kind    faultKind
+	query   *regexp.Regexp
+	err     error
+	times   int
+	fired   int
+	packets int
+	delay   time.Duration
+	code    ErrorCode
+	message string
+}
+
+type faultKind int
+
+const (
+	faultDrop faultKind = iota
+	faultLatency
+	faultStall
+	faultException
+	faultCorrupt
+)
+
+// DropAfter closes the connection after the client sent that many packets, the hello not counted.
+func DropAfter(packets int) *Fault {
+	return &Fault{kind: faultDrop, packets: packets}
+}
+
+// AddLatency delays the packets before sending them to the server.
+func AddLatency(delay time.Duration) *Fault {
+	return &Fault{kind: faultLatency, delay: delay}
+}
+
+// StallBlock sends the first half of the data blocks with rows, waits and sends the rest.
+func StallBlock(delay time.Duration) *Fault {
+	return &Fault{kind: faultStall, delay: delay}
+}
+
+// ReturnException answers queries with an exception instead of sending them to the server.
+func ReturnException(code ErrorCode, message string) *Fault {
+	return &Fault{kind: faultException, code: code, message: message}
+}
+
+// CorruptFrames flips a byte of the compressed data blocks, the server rejects them with a checksum error.
+func CorruptFrames() *Fault {
+	return &Fault{kind: faultCorrupt}
+}
+
+// ForQuery limits the fault to the queries matching the regular expression and their data blocks.
+// SetFaults reports an invalid pattern.
+func (f *Fault) ForQuery(pattern string) *Fault {
+	f.query, f.err = regexp.Compile(pattern)
+	return f
+}
+
+// Times limits how many times the fault fires.
+func (f *Fault) Times(n int) *Fault {
+	f.times = n
+	return f
+}
+
+// SetFaults replaces the faults the proxy injects, no faults are injected after SetFaults().
+// Faults with an invalid pattern are reported and left out.
+func (p *Proxy) SetFaults(faults ...*Fault) {
+	valid := make([]*Fault, 0, len(faults))
+	for _, fault := range faults {
+		if fault.err != nil {
+			p.test.Errorf("invalid pattern: %v", fault.err)
+			continue
+		}
+		valid = append(valid, fault)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.faults = valid
+}
+
+// send sends the packet read by the connection to the server, applying the faults. The block is the
+// offset of the block in data packets, rows the number of rows it has.
+func (p *Proxy) send(conn *proxyConn, packet uint64, block, rows int) error {
+	var (
+		data  = conn.packet.Bytes()
+		stall time.Duration
+	)
+	for _, fault := range p.matchingFaults(conn, packet) {
+		switch fault.kind {
+		case faultDrop:
+			if conn.counts[fault]++; conn.counts[fault] > fault.packets && p.fire(fault) {
+				return errDropped
+			}
+		case faultLatency:
+			if p.fire(fault) {
+				time.Sleep(fault.delay)
+			}
+		case faultStall:
+			if block != -1 && rows != 0 && p.fire(fault) {
+				stall = fault.delay
+			}
+		case faultException:
+			if packet == protocol.ClientQuery && p.fire(fault) {
+				conn.skip = true
+				if err := writeException(conn.client, fault.code, fault.message); err != nil {
+					return err
+				}
+			}
+		case faultCorrupt:
+			if block != -1 && conn.compress && len(data) > block+binary.HeaderSize && p.fire(fault) {
+				data = append([]byte(nil), data...)
+				data[block+binary.HeaderSize] ^= 0xff
+			}
+		}
+	}
+	defer conn.packet.Reset()
+	if conn.skip {
+		return nil
+	}
+	if stall != 0 {
+		middle := block + (len(data)-block)/2
+		if _, err := conn.server.Write(data[:middle]); err != nil {
+			return err
+		}
+		if err := conn.server.Flush(); err != nil {
+			return err
+		}
+		time.Sleep(stall)
+		data = data[middle:]
+	}
+	if _, err := conn.server.Write(data); err != nil {
+		return err
+	}
+	return conn.server.Flush()
+}
+
+// matchingFaults returns the faults that apply to the packet. Faults limited to queries
+// apply to the query packets and the data packets that follow them.
+func (p *Proxy) matchingFaults(conn *proxyConn, packet uint64) []*Fault {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var faults []*Fault
+	for _, fault := range p.faults {
+		switch {
+		case fault.query == nil:
+		case packet != protocol.ClientQuery && packet != protocol.ClientData,
+			conn.query == nil,
+			!fault.query.MatchString(conn.query.Query):
+			continue
+		}
+		faults = append(faults, fault)
+	}
+	return faults
+}
+
+// fire reports whether the fault can fire once more and counts it.
+func (p *Proxy) fire(fault *Fault) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if fault.times != 0 && fault.fired >= fault.times {
+		return false
+	}
+	fault.fired++
+	return true
+}
+
+// writeException sends an exception packet the way the server reports a failed query.
+func writeException(client *lockedWriter, code ErrorCode, message string) error {
+	var (
+		packet  bytes.Buffer
+		encoder = binary.NewEncoder(&packet)
+	)
+	encoder.Uvarint(protocol.ServerException)
+	encoder.Int32(int32(code))
+	encoder.String("DB::Exception")
+	encoder.String("DB::Exception: " + message)
+	encoder.String("")
+	encoder.Bool(false)
+	_, err := client.Write(packet.Bytes())
+	return err
+}
@@ -0,0 +1,126 @@
+package ok
+
+import (
+	"database/sql"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kshvakov/clickhouse/lib/binary"
+	"github.com/kshvakov/clickhouse/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func startFaultProxy(t *testing.T, faults ...*Fault) (*Proxy, <-chan []byte) {
+	address, received := fakeServer(t)
+	proxy, err := newProxy(t, &url.URL{Scheme: "tcp", Host: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.SetFaults(faults...)
+	return proxy, received
+}
+
+func TestFaultReturnException(t *testing.T) {
+	proxy, received := startFaultProxy(t, ReturnException(UnknownTable, "Table default.t doesn't exist.").ForQuery(`FROM t\b`).Times(1))
+	defer proxy.Close()
+	conn, encoder, sent := dialProxy(t, proxy)
+	hello := sent.Len()
+	writeQuery(t, encoder, "SELECT * FROM t", false)
+	decoder := binary.NewDecoder(conn)
+	if packet, err := decoder.Uvarint(); assert.NoError(t, err) && assert.Equal(t, uint64(protocol.ServerException), packet) {
+		code, _ := decoder.Int32()
+		name, _ := decoder.String()
+		message, _ := decoder.String()
+		decoder.String() // stack trace, unread data would reset the connection on close
+		decoder.Bool()
+		assert.Equal(t, int32(UnknownTable), code)
+		assert.Equal(t, "DB::Exception", name)
+		assert.Equal(t, "DB::Exception: Table default.t doesn't exist.", message)
+	}
+	retry := sent.Len()
+	encoder.Uvarint(protocol.ClientPing)
+	writeQuery(t, encoder, "SELECT * FROM t", false)
+	conn.Close()
+	expected := append(sent.Bytes()[:hello:hello], sent.Bytes()[retry:]...)
+	assert.Equal(t, expected, <-received)
+	assert.Len(t, proxy.Queries(), 2)
+}
+
+func TestFaultInvalidPattern(t *testing.T) {
+	recorder := errorRecorder{T: t}
+	proxy, err := newProxy(&recorder, &url.URL{Scheme: "tcp", Host: "127.0.0.1:9000"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer proxy.Close()
+	proxy.SetFaults(AddLatency(time.Second).ForQuery(`(`), DropAfter(1))
+	if assert.Len(t, recorder.errors, 1) {
+		assert.Contains(t, recorder.errors[0], "invalid pattern: ")
+	}
+	assert.Len(t, proxy.faults, 1)
+}
+
+func TestFaultDropAfter(t *testing.T) {
+	proxy, received := startFaultProxy(t, DropAfter(1))
+	defer proxy.Close()
+	conn, encoder, sent := dialProxy(t, proxy)
+	writeQueryPacket(encoder, "SELECT 1", false)
+	query := sent.Len()
+	writeBlock(t, encoder, false)
+	assert.Equal(t, sent.Bytes()[:query], <-received)
+	_, err := conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, proxy.Err())
+}
+
+func TestFaultCorruptFrames(t *testing.T) {
+	proxy, received := startFaultProxy(t, CorruptFrames().ForQuery(`^INSERT`))
+	defer proxy.Close()
+	conn, encoder, sent := dialProxy(t, proxy)
+	writeQuery(t, encoder, "SELECT 1", true)
+	corrupted := sent.Len()
+	writeQuery(t, encoder, "INSERT INTO t VALUES", true)
+	conn.Close()
+	actual := <-received
+	if assert.Len(t, actual, sent.Len()) {
+		assert.Equal(t, sent.Bytes()[:corrupted], actual[:corrupted])
+		var diff int
+		for i := range actual {
+			if actual[i] != sent.Bytes()[i] {
+				diff++
+			}
+		}
+		assert.Equal(t, 1, diff)
+	}
+}
+
+func TestFaultDelays(t *testing.T) {
+	proxy, received := startFaultProxy(t, StallBlock(50*time.Millisecond), AddLatency(10*time.Millisecond).Times(2))
+	defer proxy.Close()
+	conn, encoder, sent := dialProxy(t, proxy)
+	start := time.Now()
+	writeQuery(t, encoder, "INSERT INTO t VALUES", false)
+	encoder.Uvarint(protocol.ClientPing)
+	conn.Close()
+	assert.Equal(t, sent.Bytes(), <-received)
+	assert.True(t, time.Since(start) >= 70*time.Millisecond)
+}
+
+func TestFaults(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	proxy := clickhouse.Proxy()
+	proxy.SetFaults(ReturnException(TooManySimultaneousQueries, "Too many simultaneous queries.").ForQuery(`^SELECT`).Times(1))
+	app, err := sql.Open("clickhouse", proxy.DSN())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer app.Close()
+	var value uint8
+	clickhouse.AssertErrorCode(app.QueryRow("SELECT 1").Scan(&value), TooManySimultaneousQueries)
+	if err := app.QueryRow("SELECT 1").Scan(&value); assert.NoError(t, err) {
+		assert.Equal(t, uint8(1), value)
+	}
+}
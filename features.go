@@ -0,0 +1,187 @@
+package ok
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// feature describes a system table listing the names of a server capability.
+type feature struct {
+	what            string
+	table           string
+	caseInsensitive bool
+}
+
+var (
+	featureFunctions         = feature{what: "function", table: "functions", caseInsensitive: true}
+	featureTableEngines      = feature{what: "table engine", table: "table_engines"}
+	featureDataTypes         = feature{what: "data type", table: "data_type_families", caseInsensitive: true}
+	featureSettings          = feature{what: "setting", table: "settings"}
+	featureFormats           = feature{what: "format", table: "formats"}
+	featureDictionaryLayouts = feature{what: "dictionary layout"}
+)
+
+func (c *clickhouse) HasFunction(name string) bool {
+	return c.has(featureFunctions, name)
+}
+
+func (c *clickhouse) HasTableEngine(name string) bool {
+	return c.has(featureTableEngines, name)
+}
+
+func (c *clickhouse) HasDataType(name string) bool {
+	return c.has(featureDataTypes, name)
+}
+
+func (c *clickhouse) HasSetting(name string) bool {
+	return c.has(featureSettings, name)
+}
+
+func (c *clickhouse) HasFormat(name string) bool {
+	return c.has(featureFormats, name)
+}
+
+// HasDictionaryLayout reports whether the server can load a DDL dictionary with the layout.
+// There is no system table listing layouts, so every layout is probed once with a scratch
+// dictionary; a layout is missing only when the server does not know its name.
+func (c *clickhouse) HasDictionaryLayout(name string) bool {
+	return c.has(featureDictionaryLayouts, name)
+}
+
+func (c *clickhouse) RequireFunction(name string) {
+	c.require(featureFunctions, name)
+}
+
+func (c *clickhouse) RequireTableEngine(name string) {
+	c.require(featureTableEngines, name)
+}
+
+func (c *clickhouse) RequireDataType(name string) {
+	c.require(featureDataTypes, name)
+}
+
+func (c *clickhouse) RequireSetting(name string) {
+	c.require(featureSettings, name)
+}
+
+func (c *clickhouse) RequireFormat(name string) {
+	c.require(featureFormats, name)
+}
+
+func (c *clickhouse) RequireDictionaryLayout(name string) {
+	c.require(featureDictionaryLayouts, name)
+}
+
+func (c *clickhouse) require(f feature, name string) {
+	if !c.has(f, name) {
+		c.test.Skipf("ClickHouse server does not support %s '%s'", f.what, name)
+	}
+}
+
+func (c *clickhouse) has(f feature, name string) bool {
+	if c.features == nil {
+		c.features = make(map[string]*featureNames)
+	}
+	loaded, found := c.features[f.what]
+	if !found {
+		loaded = &featureNames{names: make(map[string]bool), lowered: make(map[string]bool)}
+		if len(f.table) != 0 {
+			if err := c.loadFeature(f, loaded); err != nil {
+				c.test.Errorf("an error occurred while reading system.%s: %v", f.table, err)
+				return false
+			}
+		}
+		c.features[f.what] = loaded
+	}
+	names := loaded.names
+	if f == featureDictionaryLayouts {
+		if exists, probed := names[strings.ToLower(name)]; probed {
+			return exists
+		}
+		exists, err := c.probeDictionaryLayout(name)
+		if err != nil {
+			c.test.Errorf("an error occurred while probing dictionary layout: %v", err)
+			return false
+		}
+		names[strings.ToLower(name)] = exists
+		return exists
+	}
+	return names[name] || loaded.lowered[strings.ToLower(name)]
+}
+
+// featureNames are the names of a feature the server supports, the lowered
+// names of the case insensitive ones are kept apart.
+type featureNames struct {
+	names   map[string]bool
+	lowered map[string]bool
+}
+
+func (c *clickhouse) loadFeature(f feature, loaded *featureNames) error {
+	query := "SELECT name, 0 FROM system." + f.table
+	if f.caseInsensitive {
+		query = "SELECT name, case_insensitive FROM system." + f.table
+	}
+	rows, err := c.conn.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name            string
+			caseInsensitive uint8
+		)
+		if err := rows.Scan(&name, &caseInsensitive); err != nil {
+			return err
+		}
+		if loaded.names[name] = true; caseInsensitive == 1 {
+			loaded.lowered[strings.ToLower(name)] = true
+		}
+	}
+	return rows.Err()
+}
+
+func (c *clickhouse) probeDictionaryLayout(layout string) (bool, error) {
+	scratch := fmt.Sprintf("ok_layout_%d", time.Now().UnixNano())
+	if _, err := c.conn.Exec("CREATE DATABASE " + scratch); err != nil {
+		return false, err
+	}
+	defer c.conn.Exec("DROP DATABASE IF EXISTS " + scratch)
+	if _, err := c.conn.Exec("CREATE TABLE " + scratch + ".source (id UInt64, key String, value String, start Date, end Date) Engine Memory"); err != nil {
+		return false, err
+	}
+	var (
+		name       = strings.ToLower(layout)
+		primaryKey = "id"
+		structure  = "id UInt64, value String"
+		lifetime   = "LIFETIME(0)"
+	)
+	switch {
+	case name == "ip_trie":
+		primaryKey, structure = "key", "key String, value String"
+	case strings.HasPrefix(name, "complex_key"):
+		primaryKey, structure = "id, key", "id UInt64, key String, value String"
+	}
+	if strings.Contains(name, "range") {
+		structure += ", start Date, end Date"
+		lifetime += " RANGE(MIN start MAX end)"
+	}
+	ddl := fmt.Sprintf("CREATE DICTIONARY %s.probe (%s) PRIMARY KEY %s SOURCE(CLICKHOUSE(TABLE 'source' DB '%s')) %s LAYOUT(%s())",
+		scratch, structure, primaryKey, scratch, lifetime, strings.ToUpper(name),
+	)
+	if _, err := c.conn.Exec(ddl); err != nil {
+		if strings.Contains(err.Error(), "Syntax error") {
+			return false, nil
+		}
+		return isKnownLayout(err), nil
+	}
+	if _, err := c.conn.Exec("SYSTEM RELOAD DICTIONARY " + scratch + ".probe"); err != nil {
+		return isKnownLayout(err), nil
+	}
+	return true, nil
+}
+
+func isKnownLayout(err error) bool {
+	return !strings.Contains(strings.ToLower(err.Error()), "unknown dictionary layout")
+}
@@ -0,0 +1,42 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatures(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	if assert.True(t, clickhouse.HasFunction("count")) {
+		assert.True(t, clickhouse.HasFunction("COUNT"))
+		assert.True(t, clickhouse.HasFunction("uniq"))
+		assert.False(t, clickhouse.HasFunction("UNIQ"))
+		assert.False(t, clickhouse.HasFunction("not_exists_function"))
+	}
+	if assert.True(t, clickhouse.HasTableEngine("Memory")) {
+		assert.False(t, clickhouse.HasTableEngine("memory"))
+	}
+	if assert.True(t, clickhouse.HasDataType("String")) {
+		assert.False(t, clickhouse.HasDataType("NotExistsType"))
+	}
+	if assert.True(t, clickhouse.HasSetting("max_memory_usage")) {
+		assert.False(t, clickhouse.HasSetting("MAX_MEMORY_USAGE"))
+	}
+	if assert.True(t, clickhouse.HasFormat("TabSeparated")) {
+		assert.False(t, clickhouse.HasFormat("NotExistsFormat"))
+	}
+	t.Run("RequireFunction", func(t *testing.T) {
+		Connect(t, "tcp://127.0.0.1:9000?debug=0").RequireFunction("not_exists_function")
+		t.Error("the test was not skipped")
+	})
+}
+
+func TestDictionaryLayouts(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.RequireVersion(">=19.17")
+	if assert.True(t, clickhouse.HasDictionaryLayout("flat")) {
+		assert.True(t, clickhouse.HasDictionaryLayout("complex_key_hashed"))
+		assert.False(t, clickhouse.HasDictionaryLayout("not_exists_layout"))
+	}
+}
@@ -0,0 +1,286 @@
+package ok
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// functionalTest matches the query files of ClickHouse functional tests, e.g. "00001_select_1.sql".
+var functionalTest = regexp.MustCompile(`^\d+_.+\.sql$`)
+
+// RunFunctionalTests runs every NNNNN_name.sql file of the directory, found via the search path,
+// as a subtest and compares the output of its queries with the NNNNN_name.reference file.
+// Statements are split like Exec does, results are formatted as TabSeparated, settings changed
+// with SET are restored and the objects created are dropped after each test.
+// With -ok.update the reference files are written instead.
+func (c *clickhouse) RunFunctionalTests(dir string) bool {
+	path, tests, err := c.functionalTests(dir)
+	if err != nil {
+		c.test.Errorf("could not read functional tests: %v", err)
+		return false
+	}
+	ok := true
+	for _, test := range tests {
+		name := strings.TrimSuffix(test, ".sql")
+		if !c.run(name, func(t T) {
+			sub := *c
+			sub.test = t
+			sub.clear.databases, sub.clear.tables, sub.clear.views, sub.clear.dictionaries, sub.clear.proxies = nil, nil, nil, nil, nil
+			defer sub.Clear()
+			sub.runFunctionalTest(filepath.Join(path, test), filepath.Join(path, name+".reference"))
+		}) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// run runs fn as a subtest of a testing.T, other reporters get the errors prefixed with the subtest name.
+func (c *clickhouse) run(name string, fn func(t T)) bool {
+	if t, ok := c.test.(*testing.T); ok {
+		return t.Run(name, func(t *testing.T) {
+			fn(t)
+		})
+	}
+	sub := subtest{T: c.test, name: c.test.Name() + "/" + name}
+	fn(&sub)
+	return !sub.failed
+}
+
+type subtest struct {
+	T
+	name   string
+	failed bool
+}
+
+func (t *subtest) Name() string {
+	return t.name
+}
+
+func (t *subtest) Failed() bool {
+	return t.failed
+}
+
+func (t *subtest) Error(args ...interface{}) {
+	t.failed = true
+	t.T.Errorf("%s: %s", t.name, fmt.Sprint(args...))
+}
+
+func (t *subtest) Errorf(format string, args ...interface{}) {
+	t.failed = true
+	t.T.Errorf("%s: "+format, append([]interface{}{t.name}, args...)...)
+}
+
+func (t *subtest) Fatal(args ...interface{}) {
+	t.failed = true
+	t.T.Fatalf("%s: %s", t.name, fmt.Sprint(args...))
+}
+
+func (t *subtest) Fatalf(format string, args ...interface{}) {
+	t.failed = true
+	t.T.Fatalf("%s: "+format, append([]interface{}{t.name}, args...)...)
+}
+
+func (c *clickhouse) functionalTests(dir string) (path string, tests []string, err error) {
+	var files []os.FileInfo
+	for _, searchPath := range c.searchPath {
+		path = filepath.Join(searchPath, dir)
+		if files, err = ioutil.ReadDir(path); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	for _, file := range files {
+		if !file.IsDir() && functionalTest.MatchString(file.Name()) {
+			tests = append(tests, file.Name())
+		}
+	}
+	sort.Strings(tests)
+	return path, tests, nil
+}
+
+func (c *clickhouse) runFunctionalTest(queryFile, referenceFile string) bool {
+	data, err := ioutil.ReadFile(queryFile)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	var (
+		output   strings.Builder
+		restore  []Setting
+		previous = c.settings.get()
+	)
+	defer func() {
+		c.settings.set(previous)
+		if err := c.applySettings(restore); err != nil {
+			c.test.Errorf("an error occurred while restoring settings: %v", err)
+		}
+	}()
+	for _, query := range strings.Split(string(data), ";\n") {
+		query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+		keyword := firstKeyword(query)
+		switch keyword {
+		case "":
+			continue
+		case "SET":
+			previous, err := c.previousSettings(query)
+			if err != nil {
+				c.test.Errorf("%s: %v", query, err)
+				return false
+			}
+			restore = append(previous, restore...)
+		}
+		rows, err := c.runFunctionalQuery(keyword, query)
+		if err != nil {
+			c.test.Errorf("%s: %v", query, err)
+			return false
+		}
+		if keyword == "SET" {
+			// the connector replays the settings when the driver reconnects after a server exception
+			c.settings.set(merge(c.settings.get(), setSettings(query)))
+		}
+		for _, row := range rows {
+			output.WriteString(strings.Join(row, "\t") + "\n")
+		}
+	}
+	if *update {
+		if err := writeGolden(referenceFile, output.String()); err != nil {
+			c.test.Errorf("could not update reference file: %v", err)
+			return false
+		}
+		return true
+	}
+	expected, err := ioutil.ReadFile(referenceFile)
+	if err != nil {
+		c.test.Errorf("could not read reference file (run with -ok.update to create it): %v", err)
+		return false
+	}
+	if string(expected) != output.String() {
+		c.test.Errorf("result differs from '%s':\n%s", referenceFile, diff(string(expected), output.String()))
+		return false
+	}
+	return true
+}
+
+// runFunctionalQuery runs statements returning rows with Query and the rest with Exec.
+func (c *clickhouse) runFunctionalQuery(keyword, query string) ([][]string, error) {
+	switch keyword {
+	case "SELECT", "WITH", "SHOW", "DESCRIBE", "DESC", "EXISTS", "EXPLAIN":
+		return c.queryRows(rewriteQuery(query, c.rewrite))
+	}
+	return nil, c.Exec(query)
+}
+
+// insertSource returns the keyword in upper case that starts the data of the INSERT statement:
+// VALUES or FORMAT for inline data, SELECT or WITH for a query, "" when there is none. String
+// literals, quoted identifiers and parentheses, e.g. the column list, are skipped.
+func insertSource(query string) string {
+	var (
+		depth int
+		word  strings.Builder
+	)
+	query = skipComments(query) + " "
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if depth == 0 && (ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9') {
+			word.WriteByte(ch)
+			continue
+		}
+		switch keyword := strings.ToUpper(word.String()); keyword {
+		case "VALUES", "FORMAT", "SELECT", "WITH":
+			return keyword
+		}
+		word.Reset()
+		switch ch {
+		case '\'', '"', '`':
+			for i++; i < len(query) && query[i] != ch; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	return ""
+}
+
+// previousSettings returns the current values of the settings the SET statement changes.
+func (c *clickhouse) previousSettings(query string) ([]Setting, error) {
+	var (
+		names   []string
+		updates = setSettings(query)
+	)
+	for _, setting := range updates {
+		names = append(names, setting.Name)
+	}
+	values, err := c.settingValues(names)
+	if err != nil {
+		return nil, err
+	}
+	settings := make([]Setting, 0, len(names))
+	for _, name := range names {
+		if value, found := values[name]; found {
+			settings = append(settings, Setting{Name: name, Value: quote(value)})
+		}
+	}
+	return settings, nil
+}
+
+// setSettings returns the assignments of the SET statement.
+func setSettings(query string) []Setting {
+	var (
+		assignments = splitList(strings.TrimSpace(skipComments(query)[len("SET"):]))
+		settings    = make([]Setting, 0, len(assignments))
+	)
+	for _, assignment := range assignments {
+		parts := strings.SplitN(assignment, "=", 2)
+		setting := Setting{Name: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			setting.Value = strings.TrimSpace(parts[1])
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// firstKeyword returns the first word of the statement in upper case, skipping comments.
+func firstKeyword(query string) string {
+	query = skipComments(query)
+	if end := strings.IndexFunc(query, func(r rune) bool { return !unicode.IsLetter(r) }); end != -1 {
+		query = query[:end]
+	}
+	return strings.ToUpper(query)
+}
+
+func skipComments(query string) string {
+	for {
+		switch query = strings.TrimSpace(query); {
+		case strings.HasPrefix(query, "--"):
+			end := strings.Index(query, "\n")
+			if end == -1 {
+				return ""
+			}
+			query = query[end+1:]
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end == -1 {
+				return ""
+			}
+			query = query[end+2:]
+		default:
+			return query
+		}
+	}
+}
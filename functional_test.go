@@ -0,0 +1,70 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstKeyword(t *testing.T) {
+	assets := map[string]string{
+		"SELECT 1":                          "SELECT",
+		"  select(1)":                       "SELECT",
+		"-- comment\nINSERT INTO t VALUES":  "INSERT",
+		"/* comment */ SET max_threads = 1": "SET",
+		"-- only a comment":                 "",
+		"":                                  "",
+	}
+	for src, expected := range assets {
+		assert.Equal(t, expected, firstKeyword(src), src)
+	}
+}
+
+func TestInsertSource(t *testing.T) {
+	assets := map[string]string{
+		"INSERT INTO t VALUES (1)":                              "VALUES",
+		"insert into t values(1)":                               "VALUES",
+		"INSERT INTO t (a, b) VALUES ('SELECT', 1)":             "VALUES",
+		"INSERT INTO t (`select`) FORMAT CSV":                   "FORMAT",
+		"-- comment\nINSERT INTO t SELECT 'VALUES'":             "SELECT",
+		"INSERT INTO t (a) WITH 1 AS x SELECT x":                "WITH",
+		"INSERT INTO selections (with_values) SELECT 1":         "SELECT",
+		"INSERT INTO FUNCTION remote('h', db.t) VALUES ('\\'')": "VALUES",
+		"INSERT INTO t": "",
+	}
+	for src, expected := range assets {
+		assert.Equal(t, expected, insertSource(src), src)
+	}
+}
+
+func TestSetSettings(t *testing.T) {
+	assets := map[string][]Setting{
+		"SET max_threads = 1":                                {{"max_threads", "1"}},
+		"-- comment\nset max_threads=1, log_comment = 'a,b'": {{"max_threads", "1"}, {"log_comment", "'a,b'"}},
+	}
+	for src, expected := range assets {
+		assert.Equal(t, expected, setSettings(src), src)
+	}
+}
+
+func TestFunctionalTestFiles(t *testing.T) {
+	c := &clickhouse{
+		test:       t,
+		searchPath: []string{"missing", "testdata"},
+	}
+	if path, tests, err := c.functionalTests("functional"); assert.NoError(t, err) {
+		assert.Equal(t, "testdata/functional", path)
+		assert.Equal(t, []string{"00001_select.sql", "00002_insert.sql"}, tests)
+	}
+	_, _, err := c.functionalTests("missing")
+	assert.Error(t, err)
+}
+
+func TestRunFunctionalTests(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	clickhouse.SetSearchPath("testdata")
+	if assert.True(t, clickhouse.RunFunctionalTests("functional")) {
+		assert.False(t, clickhouse.DatabaseExists("functional_tester"))
+	}
+}
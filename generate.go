@@ -0,0 +1,464 @@
+package ok
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generator describes the random rows Generate inserts. The same Seed generates the same rows.
+// The first rows hold the boundary values of the column types: the limits of integers, empty
+// and unusual strings, the limits of the Date and DateTime ranges, NaN and infinite floats, NULLs
+// and empty arrays. Later rows are random with a boundary value now and then.
+type Generator struct {
+	Rows int
+	Seed int64
+	// Columns overrides the values of the columns, e.g. to follow a distribution
+	// or the constraints of the table. Values are converted to the column types.
+	// The functions must be pure, the same seed then generates the same rows.
+	Columns map[string]ValueFunc
+}
+
+// ValueFunc returns the value of a column for the row with the given number, counted from 0.
+// It must not keep state between calls, AssertProperty calls it again for every case and
+// reports the seed of a failing case to regenerate its rows.
+type ValueFunc func(r *rand.Rand, row int) interface{}
+
+// OneOf picks one of the values.
+func OneOf(values ...interface{}) ValueFunc {
+	return func(r *rand.Rand, _ int) interface{} {
+		return values[r.Intn(len(values))]
+	}
+}
+
+// Between picks an integer in the range [min, max], which may span all of int64.
+// It panics if max is less than min.
+func Between(min, max int64) ValueFunc {
+	if max < min {
+		panic(fmt.Sprintf("ok: Between(%d, %d): max is less than min", min, max))
+	}
+	span := uint64(max) - uint64(min)
+	return func(r *rand.Rand, _ int) interface{} {
+		if span < math.MaxInt64 {
+			return min + r.Int63n(int64(span)+1)
+		}
+		for {
+			if v := r.Uint64(); v <= span {
+				return int64(uint64(min) + v)
+			}
+		}
+	}
+}
+
+// Sequence returns consecutive integers from start, e.g. for unique keys.
+func Sequence(start int64) ValueFunc {
+	return func(_ *rand.Rand, row int) interface{} {
+		return start + int64(row)
+	}
+}
+
+// Generate inserts the random rows of the generator into all columns of the table,
+// "database.table" or a table of the connection database.
+func (c *clickhouse) Generate(table string, generator Generator) bool {
+	database, name := c.splitName(table)
+	return c.copy("INSERT INTO "+database+"."+name+" VALUES", func(columns, types []string) ([][]interface{}, error) {
+		rows, err := generateRows(columns, types, generator)
+		if err != nil {
+			return nil, err
+		}
+		return flattenRows(rows), nil
+	})
+}
+
+// generateRows returns the rows for the columns. AggregateFunction columns get the values of their
+// staging columns, arrays of the arguments aggregated into a state, a multiValue when there are several.
+func generateRows(columns, types []string, generator Generator) ([][]interface{}, error) {
+	var (
+		random     = rand.New(rand.NewSource(generator.Seed))
+		generators = make([]func(row int) interface{}, 0, len(columns))
+	)
+	for i, column := range columns {
+		generate, err := columnGenerator(random, types[i], generator.Columns[column])
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %v", column, err)
+		}
+		generators = append(generators, generate)
+	}
+	rows := make([][]interface{}, 0, generator.Rows)
+	for row := 0; row < generator.Rows; row++ {
+		values := make([]interface{}, 0, len(columns))
+		for _, generate := range generators {
+			values = append(values, generate(row))
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func columnGenerator(random *rand.Rand, columnType string, override ValueFunc) (func(row int) interface{}, error) {
+	if f, ok := parseAggregateFunction(columnType); ok {
+		return aggregateGenerator(random, f, override)
+	}
+	if override != nil {
+		return func(row int) interface{} {
+			return toGoValue(override(random, row), columnType)
+		}, nil
+	}
+	values, err := newValueGenerator(columnType)
+	if err != nil {
+		return nil, err
+	}
+	return func(row int) interface{} {
+		return values.value(random, row)
+	}, nil
+}
+
+// aggregateGenerator generates the staging values of the column: an argument value for SimpleAggregateFunction,
+// arrays of the same length per argument for AggregateFunction, empty in the first row. An override returns a value, a slice
+// of values or a multiValue with a slice per argument.
+func aggregateGenerator(random *rand.Rand, f *aggregateFunction, override ValueFunc) (func(row int) interface{}, error) {
+	if f.simple {
+		return columnGenerator(random, f.arguments[0], override)
+	}
+	arguments := make([]*valueGenerator, 0, len(f.arguments))
+	for _, argument := range f.arguments {
+		values, err := newValueGenerator(argument)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, values)
+	}
+	return func(row int) interface{} {
+		if override != nil {
+			switch value := override(random, row).(type) {
+			case multiValue:
+				return value
+			default:
+				if kind := reflect.ValueOf(value).Kind(); kind != reflect.Slice || strings.HasPrefix(f.arguments[0], "Array(") {
+					value = []interface{}{value}
+				}
+				return toGoValue(value, "Array("+f.arguments[0]+")")
+			}
+		}
+		var (
+			size   int
+			values = make(multiValue, 0, len(arguments))
+		)
+		if row != 0 {
+			size = random.Intn(4)
+		}
+		for _, argument := range arguments {
+			slice := reflect.MakeSlice(reflect.SliceOf(argument.goType), 0, size)
+			for i := 0; i < size; i++ {
+				slice = reflect.Append(slice, reflect.ValueOf(argument.value(random, row*size+i)))
+			}
+			values = append(values, slice.Interface())
+		}
+		if len(values) == 1 {
+			return values[0]
+		}
+		return values
+	}, nil
+}
+
+// flattenRows spreads the multiValues over the staging columns the way the converters do.
+func flattenRows(rows [][]interface{}) [][]interface{} {
+	flattened := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		values := make([]interface{}, 0, len(row))
+		for _, value := range row {
+			if multi, ok := value.(multiValue); ok {
+				values = append(values, multi...)
+				continue
+			}
+			values = append(values, value)
+		}
+		flattened = append(flattened, values)
+	}
+	return flattened
+}
+
+// valueGenerator generates the values of a column type, the boundaries come first.
+type valueGenerator struct {
+	goType     reflect.Type
+	boundaries []interface{}
+	random     func(r *rand.Rand) interface{}
+}
+
+// value returns the boundary value of the row and later random values, a tenth of them boundaries.
+func (g *valueGenerator) value(r *rand.Rand, row int) interface{} {
+	switch {
+	case row < len(g.boundaries):
+		return g.boundaries[row]
+	case r.Intn(10) == 0:
+		return g.boundaries[r.Intn(len(g.boundaries))]
+	}
+	return g.random(r)
+}
+
+var (
+	minDate     = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDate     = time.Date(2149, 6, 6, 0, 0, 0, 0, time.UTC)
+	maxDateTime = time.Unix(math.MaxUint32, 0).UTC()
+	alphabet    = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 _-.,;:'\"\\\t\näöüßяж✓€")
+)
+
+func newValueGenerator(columnType string) (*valueGenerator, error) {
+	if strings.HasPrefix(columnType, "LowCardinality(") {
+		return newValueGenerator(columnType[len("LowCardinality(") : len(columnType)-1])
+	}
+	goType, ok := columnGoType(columnType)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("type %s is not supported, override the column", columnType)
+	case strings.HasPrefix(columnType, "Array(Nullable("):
+		return nil, fmt.Errorf("type %s is not supported by the driver", columnType)
+	}
+	g := valueGenerator{goType: goType}
+	switch {
+	case strings.HasPrefix(columnType, "Nullable("):
+		inner, err := newValueGenerator(columnType[len("Nullable(") : len(columnType)-1])
+		if err != nil {
+			return nil, err
+		}
+		g.goType = inner.goType
+		g.boundaries = append([]interface{}{nil}, inner.boundaries...)
+		g.random = func(r *rand.Rand) interface{} {
+			if r.Intn(10) == 0 {
+				return nil
+			}
+			return inner.random(r)
+		}
+	case strings.HasPrefix(columnType, "Array("):
+		elem, err := newValueGenerator(columnType[len("Array(") : len(columnType)-1])
+		if err != nil {
+			return nil, err
+		}
+		g.boundaries = []interface{}{
+			reflect.MakeSlice(goType, 0, 0).Interface(),
+			sliceOf(goType, elem.boundaries),
+		}
+		g.random = func(r *rand.Rand) interface{} {
+			values := make([]interface{}, r.Intn(5))
+			for i := range values {
+				values[i] = elem.value(r, len(elem.boundaries))
+			}
+			return sliceOf(goType, values)
+		}
+	case strings.HasPrefix(columnType, "Enum"):
+		names, err := enumNames(columnType)
+		if err != nil {
+			return nil, err
+		}
+		g.boundaries = []interface{}{names[0], names[len(names)-1]}
+		g.random = func(r *rand.Rand) interface{} {
+			return names[r.Intn(len(names))]
+		}
+	case strings.HasPrefix(columnType, "FixedString("):
+		size, err := strconv.Atoi(columnType[len("FixedString(") : len(columnType)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid type %s", columnType)
+		}
+		g.boundaries = []interface{}{"", strings.Repeat("z", size)}
+		g.random = func(r *rand.Rand) interface{} {
+			value := make([]byte, r.Intn(size+1))
+			for i := range value {
+				value[i] = byte('a' + r.Intn(26))
+			}
+			return string(value)
+		}
+	case strings.HasPrefix(columnType, "Decimal"):
+		precision, scale, err := decimalPrecision(columnType)
+		if err != nil {
+			return nil, err
+		}
+		if precision > 18 {
+			return nil, fmt.Errorf("type %s is not supported by the driver", columnType)
+		}
+		// the driver writes decimals from float64, keep the digits it represents exactly
+		if precision > 15 {
+			precision = 15
+		}
+		var (
+			factor = math.Pow10(scale)
+			max    = math.Pow10(precision-scale) - 1/factor
+		)
+		g.boundaries = []interface{}{0.0, max, -max, 1 / factor}
+		g.random = func(r *rand.Rand) interface{} {
+			return math.Trunc((r.Float64()*2-1)*max*factor) / factor
+		}
+	case columnType == "Date":
+		g.boundaries = []interface{}{minDate, maxDate}
+		g.random = func(r *rand.Rand) interface{} {
+			return minDate.AddDate(0, 0, r.Intn(math.MaxUint16+1))
+		}
+	case columnType == "DateTime" || strings.HasPrefix(columnType, "DateTime("):
+		g.boundaries = []interface{}{minDate, maxDateTime}
+		g.random = func(r *rand.Rand) interface{} {
+			return time.Unix(int64(r.Uint32()), 0).UTC()
+		}
+	case columnType == "UUID":
+		g.boundaries = []interface{}{"00000000-0000-0000-0000-000000000000", "ffffffff-ffff-ffff-ffff-ffffffffffff"}
+		g.random = func(r *rand.Rand) interface{} {
+			value := fmt.Sprintf("%016x%016x", r.Uint64(), r.Uint64())
+			return value[:8] + "-" + value[8:12] + "-" + value[12:16] + "-" + value[16:20] + "-" + value[20:]
+		}
+	case columnType == "String":
+		g.boundaries = []interface{}{"", "\x00", "tab\tnewline\nquotes'\"backslash\\", "юникод ✓", strings.Repeat("x", 1024)}
+		g.random = func(r *rand.Rand) interface{} {
+			value := make([]rune, r.Intn(33))
+			for i := range value {
+				value[i] = alphabet[r.Intn(len(alphabet))]
+			}
+			return string(value)
+		}
+	case columnType == "Float32":
+		g.boundaries = []interface{}{
+			float32(0), float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1)),
+			float32(math.MaxFloat32), float32(-math.MaxFloat32), float32(math.SmallestNonzeroFloat32),
+		}
+		g.random = func(r *rand.Rand) interface{} {
+			return float32(r.NormFloat64() * 1000)
+		}
+	case columnType == "Float64":
+		g.boundaries = []interface{}{
+			0.0, math.NaN(), math.Inf(1), math.Inf(-1), math.MaxFloat64, -math.MaxFloat64, math.SmallestNonzeroFloat64,
+		}
+		g.random = func(r *rand.Rand) interface{} {
+			return r.NormFloat64() * 1000
+		}
+	case goType.Kind() >= reflect.Int8 && goType.Kind() <= reflect.Int64:
+		var (
+			bits = uint(goType.Bits())
+			min  = int64(-1) << (bits - 1)
+		)
+		g.boundaries = convertAll(goType, min, ^min, int64(0), int64(-1), int64(1))
+		g.random = func(r *rand.Rand) interface{} {
+			return reflect.ValueOf(int64(r.Uint64())).Convert(goType).Interface()
+		}
+	case goType.Kind() >= reflect.Uint8 && goType.Kind() <= reflect.Uint64:
+		max := ^uint64(0) >> (64 - uint(goType.Bits()))
+		g.boundaries = convertAll(goType, uint64(0), max, uint64(1))
+		g.random = func(r *rand.Rand) interface{} {
+			return reflect.ValueOf(r.Uint64()).Convert(goType).Interface()
+		}
+	default:
+		return nil, fmt.Errorf("type %s is not supported, override the column", columnType)
+	}
+	return &g, nil
+}
+
+func convertAll(t reflect.Type, values ...interface{}) []interface{} {
+	converted := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		converted = append(converted, reflect.ValueOf(value).Convert(t).Interface())
+	}
+	return converted
+}
+
+// sliceOf returns the values as a slice of the type, NULLs are skipped unless the elements are pointers.
+func sliceOf(t reflect.Type, values []interface{}) interface{} {
+	slice := reflect.MakeSlice(t, 0, len(values))
+	for _, value := range values {
+		switch {
+		case t.Elem().Kind() == reflect.Ptr:
+			elem := reflect.Zero(t.Elem())
+			if value != nil {
+				elem = reflect.New(t.Elem().Elem())
+				elem.Elem().Set(reflect.ValueOf(value))
+			}
+			slice = reflect.Append(slice, elem)
+		case value != nil:
+			slice = reflect.Append(slice, reflect.ValueOf(value))
+		}
+	}
+	return slice.Interface()
+}
+
+// toGoValue converts the numbers returned by overrides to the Go type of the column, e.g. an int to an int8.
+func toGoValue(value interface{}, columnType string) interface{} {
+	if value == nil {
+		return nil
+	}
+	if strings.HasPrefix(columnType, "Nullable(") {
+		columnType = columnType[len("Nullable(") : len(columnType)-1]
+	}
+	expected, ok := columnGoType(columnType)
+	if !ok {
+		return value
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type() == expected:
+		return value
+	case isNumber(v.Kind()) && isNumber(expected.Kind()):
+		return v.Convert(expected).Interface()
+	case v.Kind() == reflect.Slice && expected.Kind() == reflect.Slice:
+		values := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, toGoValue(v.Index(i).Interface(), columnType[len("Array("):len(columnType)-1]))
+		}
+		return sliceOf(expected, values)
+	}
+	return value
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+// enumNames returns the names of an Enum8('a' = 1, 'b' = 2) type.
+func enumNames(columnType string) ([]string, error) {
+	start := strings.Index(columnType, "(")
+	if start == -1 || !strings.HasSuffix(columnType, ")") {
+		return nil, fmt.Errorf("invalid type %s", columnType)
+	}
+	var names []string
+	for _, value := range splitList(columnType[start+1 : len(columnType)-1]) {
+		name := strings.TrimSpace(value)
+		if end := strings.LastIndex(name, "="); end != -1 {
+			name = strings.TrimSpace(name[:end])
+		}
+		if len(name) < 2 || name[0] != '\'' || name[len(name)-1] != '\'' {
+			return nil, fmt.Errorf("invalid type %s", columnType)
+		}
+		names = append(names, unescapeQuoted.Replace(name[1:len(name)-1]))
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("invalid type %s", columnType)
+	}
+	return names, nil
+}
+
+// decimalPrecision returns the precision and the scale of a Decimal(P, S), Decimal32(S), Decimal64(S) or Decimal128(S) type.
+func decimalPrecision(columnType string) (precision, scale int, err error) {
+	start := strings.Index(columnType, "(")
+	if start == -1 || !strings.HasSuffix(columnType, ")") {
+		return 0, 0, fmt.Errorf("invalid type %s", columnType)
+	}
+	args := strings.Split(columnType[start+1:len(columnType)-1], ",")
+	switch columnType[:start] {
+	case "Decimal32":
+		precision = 9
+	case "Decimal64":
+		precision = 18
+	case "Decimal128":
+		precision = 38
+	case "Decimal":
+		if len(args) != 2 {
+			return 0, 0, fmt.Errorf("invalid type %s", columnType)
+		}
+		if precision, err = strconv.Atoi(strings.TrimSpace(args[0])); err != nil {
+			return 0, 0, fmt.Errorf("invalid type %s", columnType)
+		}
+		args = args[1:]
+	}
+	if scale, err = strconv.Atoi(strings.TrimSpace(args[len(args)-1])); err != nil {
+		return 0, 0, fmt.Errorf("invalid type %s", columnType)
+	}
+	return precision, scale, nil
+}
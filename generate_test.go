@@ -0,0 +1,144 @@
+package ok
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateRows(t *testing.T) {
+	var (
+		columns   = []string{"id", "value", "name", "day", "tags", "state", "kind", "amount", "maybe"}
+		types     = []string{"UInt64", "Float64", "String", "Date", "Array(Int16)", "AggregateFunction(argMax, String, UInt32)", "Enum8('a' = 1, 'it\\'s' = 2)", "Decimal(9, 2)", "Nullable(Int8)"}
+		generator = Generator{
+			Rows: 100,
+			Seed: 42,
+			Columns: map[string]ValueFunc{
+				"id": Sequence(1),
+			},
+		}
+	)
+	rows, err := generateRows(columns, types, generator)
+	if assert.NoError(t, err) && assert.Len(t, rows, 100) {
+		assert.Equal(t, []interface{}{
+			uint64(1), 0.0, "", minDate, []int16{}, multiValue{[]string{}, []uint32{}}, "a", 0.0, nil,
+		}, rows[0])
+		assert.Equal(t, uint64(2), rows[1][0])
+		assert.True(t, math.IsNaN(rows[1][1].(float64)))
+		assert.Equal(t, maxDate, rows[1][3])
+		assert.Equal(t, []int16{math.MinInt16, math.MaxInt16, 0, -1, 1}, rows[1][4])
+		assert.Equal(t, "it's", rows[1][6])
+		assert.Equal(t, 9999999.99, rows[1][7])
+		assert.Equal(t, int8(math.MinInt8), rows[1][8])
+		for _, row := range flattenRows(rows) {
+			if assert.Len(t, row, len(columns)+1) {
+				assert.Len(t, row[6], len(row[5].([]string)))
+			}
+		}
+		again, _ := generateRows(columns, types, generator)
+		assert.Equal(t, fmt.Sprint(rows), fmt.Sprint(again), "the same seed generates the same rows")
+		other, _ := generateRows(columns, types, Generator{Rows: 100, Seed: 43})
+		assert.NotEqual(t, fmt.Sprint(rows), fmt.Sprint(other))
+	}
+	_, err = generateRows([]string{"point"}, []string{"Tuple(Float64, Float64)"}, Generator{Rows: 1})
+	if assert.Error(t, err) {
+		assert.Equal(t, "column 'point': type Tuple(Float64, Float64) is not supported, override the column", err.Error())
+	}
+	_, err = generateRows([]string{"scores"}, []string{"Array(Nullable(Int32))"}, Generator{Rows: 1})
+	if assert.Error(t, err) {
+		assert.Equal(t, "column 'scores': type Array(Nullable(Int32)) is not supported by the driver", err.Error())
+	}
+	if rows, err := generateRows([]string{"status"}, []string{"LowCardinality(String)"}, Generator{Rows: 10}); assert.NoError(t, err) {
+		assert.IsType(t, "", rows[0][0])
+	}
+}
+
+func TestGenerateOverrides(t *testing.T) {
+	rows, err := generateRows(
+		[]string{"id", "status", "event_time", "visits"},
+		[]string{"UInt8", "LowCardinality(String)", "DateTime", "AggregateFunction(uniq, UInt64)"},
+		Generator{
+			Rows: 50,
+			Columns: map[string]ValueFunc{
+				"id":         Between(10, 20),
+				"status":     OneOf("new", "done"),
+				"event_time": func(r *rand.Rand, _ int) interface{} { return time.Unix(1e9+r.Int63n(3600), 0) },
+				"visits":     OneOf(1, []int{1, 2}),
+			},
+		},
+	)
+	if assert.NoError(t, err) {
+		for _, row := range rows {
+			if assert.IsType(t, uint8(0), row[0]) {
+				assert.True(t, row[0].(uint8) >= 10 && row[0].(uint8) <= 20)
+			}
+			assert.Contains(t, []interface{}{"new", "done"}, row[1])
+			assert.IsType(t, time.Time{}, row[2])
+			assert.Contains(t, []interface{}{[]uint64{1}, []uint64{1, 2}}, row[3])
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	for _, bounds := range [][2]int64{{-1, -1}, {-5, 5}, {math.MinInt64, math.MaxInt64}, {-1, math.MaxInt64}, {math.MinInt64, 0}} {
+		between := Between(bounds[0], bounds[1])
+		for i := 0; i < 100; i++ {
+			if v, ok := between(r, i).(int64); assert.True(t, ok) {
+				assert.True(t, bounds[0] <= v && v <= bounds[1], "%d is not in %v", v, bounds)
+			}
+		}
+	}
+	assert.PanicsWithValue(t, "ok: Between(2, 1): max is less than min", func() { Between(2, 1) })
+}
+
+func TestGenerate(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	ddl := `
+		CREATE DATABASE generate_tester;
+		CREATE TABLE generate_tester.events (
+			id         UInt64,
+			event_date Date,
+			event_time DateTime,
+			user       String,
+			code       FixedString(2),
+			score      Nullable(Float32),
+			tags       Array(String),
+			amount     Decimal(18, 4),
+			users      AggregateFunction(uniq, String),
+			month      UInt32 MATERIALIZED toYYYYMM(event_date),
+			user_hash  UInt64 ALIAS cityHash64(user)
+		) Engine AggregatingMergeTree PARTITION BY toYYYYMM(event_date) ORDER BY id;
+	`
+	if !assert.NoError(t, clickhouse.Exec(ddl)) {
+		return
+	}
+	generator := Generator{
+		Rows: 1000,
+		Seed: 1,
+		Columns: map[string]ValueFunc{
+			"id":         Sequence(1),
+			"event_date": func(r *rand.Rand, _ int) interface{} { return time.Date(2019, 1, 1+r.Intn(60), 0, 0, 0, 0, time.UTC) },
+		},
+	}
+	if clickhouse.Generate("generate_tester.events", generator) {
+		var (
+			count, ids uint64
+			empty      uint64
+		)
+		if err := clickhouse.DB().QueryRow("SELECT count(), uniqExact(id), countIf(empty(tags)) FROM generate_tester.events").Scan(&count, &ids, &empty); assert.NoError(t, err) {
+			assert.Equal(t, uint64(1000), count)
+			assert.Equal(t, uint64(1000), ids)
+			assert.True(t, empty > 0)
+		}
+		var months uint64
+		if err := clickhouse.DB().QueryRow("SELECT countIf(month IN (201901, 201902, 201903)) FROM generate_tester.events").Scan(&months); assert.NoError(t, err) {
+			assert.Equal(t, uint64(1000), months)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package ok
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const migrationsTable = "ok_schema_migrations"
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change loaded from
+// a pair of NNN_name.up.sql and NNN_name.down.sql files.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (c *clickhouse) MigrateUp(dir string) bool {
+	migrations, err := c.loadMigrations(dir)
+	if err != nil {
+		c.test.Errorf("could not load migrations: %v", err)
+		return false
+	}
+	if len(migrations) == 0 {
+		return true
+	}
+	return c.migrateTo(migrations, migrations[len(migrations)-1].Version)
+}
+
+func (c *clickhouse) MigrateDown(dir string) bool {
+	migrations, err := c.loadMigrations(dir)
+	if err != nil {
+		c.test.Errorf("could not load migrations: %v", err)
+		return false
+	}
+	return c.migrateTo(migrations, 0)
+}
+
+func (c *clickhouse) MigrateTo(dir string, version uint64) bool {
+	migrations, err := c.loadMigrations(dir)
+	if err != nil {
+		c.test.Errorf("could not load migrations: %v", err)
+		return false
+	}
+	if version != 0 {
+		var found bool
+		for _, migration := range migrations {
+			if migration.Version == version {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.test.Errorf("migration %d does not exists", version)
+			return false
+		}
+	}
+	return c.migrateTo(migrations, version)
+}
+
+// MigrateVerify applies every pending migration and checks that rolling it back
+// restores the schema it was applied to. Verified migrations are left applied.
+func (c *clickhouse) MigrateVerify(dir string) bool {
+	migrations, err := c.loadMigrations(dir)
+	if err != nil {
+		c.test.Errorf("could not load migrations: %v", err)
+		return false
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		c.test.Errorf("could not read applied migrations: %v", err)
+		return false
+	}
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		before, err := c.schemaState()
+		if err != nil {
+			c.test.Errorf("could not read schema: %v", err)
+			return false
+		}
+		if err := c.applyMigration(migration, true); err != nil {
+			c.test.Error(err)
+			return false
+		}
+		if err := c.applyMigration(migration, false); err != nil {
+			c.test.Error(err)
+			return false
+		}
+		after, err := c.schemaState()
+		if err != nil {
+			c.test.Errorf("could not read schema: %v", err)
+			return false
+		}
+		if changes := diffSchemaState(before, after); len(changes) != 0 {
+			c.test.Errorf("migration %d_%s: down does not revert up:\n%s", migration.Version, migration.Name, changes)
+			return false
+		}
+		if err := c.applyMigration(migration, true); err != nil {
+			c.test.Error(err)
+			return false
+		}
+	}
+	return true
+}
+
+func (c *clickhouse) MigrationVersion() (uint64, error) {
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	var version uint64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+func (c *clickhouse) migrateTo(migrations []Migration, version uint64) bool {
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		c.test.Errorf("could not read applied migrations: %v", err)
+		return false
+	}
+	for _, migration := range migrations {
+		if migration.Version <= version && !applied[migration.Version] {
+			if err := c.applyMigration(migration, true); err != nil {
+				c.test.Error(err)
+				return false
+			}
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if migration := migrations[i]; migration.Version > version && applied[migration.Version] {
+			if err := c.applyMigration(migration, false); err != nil {
+				c.test.Error(err)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c *clickhouse) applyMigration(migration Migration, up bool) error {
+	var (
+		script    = migration.Up
+		direction = "up"
+	)
+	if !up {
+		script, direction = migration.Down, "down"
+		if len(script) == 0 {
+			return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+	}
+	if err := c.Exec(script); err != nil {
+		return fmt.Errorf("an error occurred while applying migration %d_%s (%s): %v", migration.Version, migration.Name, direction, err)
+	}
+	var applied uint8
+	if up {
+		applied = 1
+	}
+	query := "INSERT INTO " + c.database + "." + migrationsTable + " (version, name, applied, sequence, event_time) VALUES (?, ?, ?, ?, ?)"
+	if err := c.insert(query, [][]interface{}{
+		{migration.Version, migration.Name, applied, uint64(time.Now().UnixNano()), time.Now()},
+	}); err != nil {
+		return fmt.Errorf("could not record migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func (c *clickhouse) appliedMigrations() (map[uint64]bool, error) {
+	// the bookkeeping table is not rewritten, it is tracked so Clear drops the records along with the migrated schema
+	if _, err := c.conn.Exec(fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		version      UInt64
+		, name       String
+		, applied    UInt8
+		, sequence   UInt64
+		, event_time DateTime
+	) Engine TinyLog
+	`, c.database, migrationsTable)); err != nil {
+		return nil, err
+	}
+	if !c.tracked(c.database, migrationsTable) {
+		c.clear.tables = append(c.clear.tables, []string{c.database, migrationsTable})
+	}
+	rows, err := c.conn.Query("SELECT version FROM " + c.database + "." + migrationsTable + " GROUP BY version HAVING argMax(applied, sequence) = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[uint64]bool)
+	for rows.Next() {
+		var version uint64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func (c *clickhouse) loadMigrations(dir string) ([]Migration, error) {
+	var (
+		err   error
+		files []string
+		path  string
+	)
+	for _, searchPath := range c.searchPath {
+		path = filepath.Join(searchPath, dir)
+		if files, err = readDir(path); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMigrations(path, files)
+}
+
+func parseMigrations(dir string, files []string) ([]Migration, error) {
+	versions := make(map[uint64]*Migration)
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(file)
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version '%s': %v", file, err)
+		}
+		if version == 0 {
+			return nil, fmt.Errorf("invalid migration version '%s': versions start at 1", file)
+		}
+		migration, found := versions[version]
+		switch {
+		case !found:
+			migration = &Migration{Version: version, Name: match[2]}
+			versions[version] = migration
+		case migration.Name != match[2]:
+			return nil, fmt.Errorf("duplicate migration version %d: '%s' and '%s'", version, migration.Name, match[2])
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		switch match[3] {
+		case "up":
+			migration.Up = string(data)
+		case "down":
+			migration.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(versions))
+	for _, migration := range versions {
+		if len(migration.Up) == 0 {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func readDir(path string) ([]string, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			files = append(files, info.Name())
+		}
+	}
+	return files, nil
+}
+
+// schemaState returns the CREATE statement of every user table keyed by its
+// full name; databases are keyed by their name with an empty statement.
+func (c *clickhouse) schemaState() (map[string]string, error) {
+	const query = `
+		SELECT
+			database
+			, name
+			, create_table_query
+		FROM system.tables
+		WHERE database NOT IN ('system', 'INFORMATION_SCHEMA', 'information_schema')
+			AND NOT (database = ? AND name = ?)
+	`
+	rows, err := c.conn.Query(query, c.database, migrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	state := make(map[string]string)
+	for rows.Next() {
+		var database, table, ddl string
+		if err := rows.Scan(&database, &table, &ddl); err != nil {
+			return nil, err
+		}
+		state[database+"."+table] = ddl
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	databases, err := c.ShowDatabases()
+	if err != nil {
+		return nil, err
+	}
+	for _, database := range databases {
+		switch database {
+		case "system", "INFORMATION_SCHEMA", "information_schema":
+		default:
+			state[database] = ""
+		}
+	}
+	return state, nil
+}
+
+func diffSchemaState(before, after map[string]string) (changes string) {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, found := before[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		was, existed := before[name]
+		is, exists := after[name]
+		switch {
+		case existed && !exists:
+			changes += fmt.Sprintf("\t- %s was dropped\n", name)
+		case !existed && exists:
+			changes += fmt.Sprintf("\t- %s was left behind\n", name)
+		case was != is:
+			changes += fmt.Sprintf("\t- %s was changed\n\t\tbefore: %s\n\t\tafter:  %s\n", name, was, is)
+		}
+	}
+	return changes
+}
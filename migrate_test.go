@@ -0,0 +1,61 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMigrations(t *testing.T) {
+	files, err := readDir("testdata/migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+	if migrations, err := parseMigrations("testdata/migrations", files); assert.NoError(t, err) && assert.Len(t, migrations, 3) {
+		for i, name := range []string{"create_database", "create_events", "add_value"} {
+			if assert.Equal(t, uint64(i+1), migrations[i].Version) {
+				assert.Equal(t, name, migrations[i].Name)
+				assert.NotEmpty(t, migrations[i].Up)
+				assert.NotEmpty(t, migrations[i].Down)
+			}
+		}
+	}
+	if _, err := parseMigrations("testdata/migrations", []string{"001_create_database.down.sql"}); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "has no up script")
+	}
+	if _, err := parseMigrations("testdata/migrations", []string{"001_create_database.up.sql", "001_create_events.up.sql"}); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "duplicate migration version")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.SetSearchPath("testdata")
+	defer clickhouse.Clear()
+	if assert.True(t, clickhouse.MigrateUp("migrations")) {
+		if version, err := clickhouse.MigrationVersion(); assert.NoError(t, err) {
+			assert.Equal(t, uint64(3), version)
+		}
+		assert.True(t, clickhouse.TableExists("migrations_tester", "events"))
+	}
+	if assert.True(t, clickhouse.MigrateTo("migrations", 1)) {
+		if version, err := clickhouse.MigrationVersion(); assert.NoError(t, err) {
+			assert.Equal(t, uint64(1), version)
+		}
+		assert.False(t, clickhouse.TableExists("migrations_tester", "events"))
+	}
+	if assert.True(t, clickhouse.MigrateDown("migrations")) {
+		if version, err := clickhouse.MigrationVersion(); assert.NoError(t, err) {
+			assert.Equal(t, uint64(0), version)
+		}
+		assert.False(t, clickhouse.DatabaseExists("migrations_tester"))
+	}
+	assert.True(t, clickhouse.MigrateVerify("migrations"))
+	// Clear drops the applied migrations along with the schema, migrating again recreates it
+	if assert.True(t, clickhouse.Clear()) && assert.True(t, clickhouse.MigrateUp("migrations")) {
+		if version, err := clickhouse.MigrationVersion(); assert.NoError(t, err) {
+			assert.Equal(t, uint64(3), version)
+		}
+		assert.True(t, clickhouse.TableExists("migrations_tester", "events"))
+	}
+}
@@ -0,0 +1,105 @@
+package ok
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Pipeline describes a materialized view test: the fixture rows are inserted into
+// the source table and the targets are checked once the views have processed them.
+type Pipeline struct {
+	// Source is the insert query the fixture is loaded with, e.g. "INSERT INTO db.events VALUES".
+	Source string
+	// Fixture is a CSV file, or a TSV file when it has the .tsv extension, found via the search path.
+	Fixture string
+	// Rows are CSV rows inserted instead of a fixture file.
+	Rows    string
+	Targets []PipelineTarget
+}
+
+type PipelineTarget struct {
+	// Table is "database.table" or a table of the connection database.
+	// Without a query all its rows are compared, ordered by every column.
+	Table string
+	// Query selects the rows to compare instead of the whole table, e.g. to
+	// finalize AggregateFunction columns with -Merge functions.
+	Query string
+	// Optimize runs OPTIMIZE FINAL on the table before comparing, so
+	// SummingMergeTree and AggregatingMergeTree rows are collapsed.
+	Optimize bool
+	// Expected rows in the TabSeparated format.
+	Expected string
+}
+
+// AssertPipeline inserts the fixture into the source table and waits until every target
+// contains the expected rows. The differences of the last attempt are reported on timeout.
+func (c *clickhouse) AssertPipeline(pipeline Pipeline) bool {
+	var loaded bool
+	switch {
+	case len(pipeline.Fixture) != 0 && strings.EqualFold(filepath.Ext(pipeline.Fixture), ".tsv"):
+		loaded = c.CopyFromTSVFile(pipeline.Fixture, pipeline.Source)
+	case len(pipeline.Fixture) != 0:
+		loaded = c.CopyFromCSVFile(pipeline.Fixture, pipeline.Source)
+	default:
+		loaded = c.CopyFromCSVReader(strings.NewReader(pipeline.Rows), pipeline.Source)
+	}
+	if !loaded {
+		return false
+	}
+	ok := true
+	for _, target := range pipeline.Targets {
+		if !c.assertPipelineTarget(target) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (c *clickhouse) assertPipelineTarget(target PipelineTarget) bool {
+	name, query := target.Query, target.Query
+	if len(target.Table) != 0 {
+		name = c.qualify(target.Table)
+		if len(query) == 0 {
+			query = "SELECT * FROM " + name + " ORDER BY tuple(*)"
+		}
+	}
+	if len(query) == 0 {
+		c.test.Error("pipeline target has neither a table nor a query")
+		return false
+	}
+	if target.Optimize && len(target.Table) == 0 {
+		c.test.Errorf("pipeline target '%s': OPTIMIZE FINAL needs a table", name)
+		return false
+	}
+	var (
+		actual   string
+		expected = strings.Trim(target.Expected, "\n")
+	)
+	err := c.poll(c.timeout(), func() (bool, error) {
+		if target.Optimize {
+			database, table := c.splitName(target.Table)
+			if err := c.optimizeFinal(database, table); err != nil {
+				return false, err
+			}
+		}
+		rows, err := c.queryRows(query)
+		if err != nil {
+			return false, err
+		}
+		lines := make([]string, 0, len(rows))
+		for _, row := range rows {
+			lines = append(lines, strings.Join(row, "\t"))
+		}
+		actual = strings.Join(lines, "\n")
+		return actual == expected, nil
+	})
+	switch {
+	case err == errTimeout:
+		c.test.Errorf("pipeline target '%s' does not contain the expected rows:\n%s", name, diff(expected+"\n", actual+"\n"))
+		return false
+	case err != nil:
+		c.test.Errorf("an error occurred while checking pipeline target '%s': %v", name, err)
+		return false
+	}
+	return true
+}
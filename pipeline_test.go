@@ -0,0 +1,63 @@
+package ok
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.SetWaitTimeout(10 * time.Second)
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE pipeline_tester;
+	CREATE TABLE pipeline_tester.events (
+		event_time DateTime
+		, user_id  UInt64
+		, value    UInt64
+	) Engine MergeTree ORDER BY event_time;
+	CREATE TABLE pipeline_tester.daily (
+		day      Date
+		, value  UInt64
+	) Engine SummingMergeTree ORDER BY day;
+	CREATE TABLE pipeline_tester.daily_users (
+		day     Date
+		, users AggregateFunction(uniq, UInt64)
+	) Engine AggregatingMergeTree ORDER BY day;
+	CREATE MATERIALIZED VIEW pipeline_tester.daily_mv TO pipeline_tester.daily AS
+		SELECT toDate(event_time) AS day, value FROM pipeline_tester.events;
+	CREATE MATERIALIZED VIEW pipeline_tester.daily_users_mv TO pipeline_tester.daily_users AS
+		SELECT toDate(event_time) AS day, uniqState(user_id) AS users FROM pipeline_tester.events GROUP BY day;
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, clickhouse.AssertPipeline(Pipeline{
+		Source:  "INSERT INTO pipeline_tester.events VALUES",
+		Fixture: "testdata/pipeline/events.csv",
+		Targets: []PipelineTarget{
+			{
+				Table:    "pipeline_tester.daily",
+				Optimize: true,
+				Expected: "2020-01-01\t22\n2020-01-02\t1\n",
+			},
+			{
+				Query:    "SELECT day, uniqMerge(users) FROM pipeline_tester.daily_users GROUP BY day ORDER BY day",
+				Expected: "2020-01-01\t2\n2020-01-02\t1\n",
+			},
+		},
+	}))
+	assert.True(t, clickhouse.AssertPipeline(Pipeline{
+		Source: "INSERT INTO pipeline_tester.events VALUES",
+		Rows:   "2020-01-02 12:00:00,3,4\n",
+		Targets: []PipelineTarget{
+			{
+				Table:    "pipeline_tester.daily",
+				Optimize: true,
+				Expected: "2020-01-01\t22\n2020-01-02\t5\n",
+			},
+		},
+	}))
+}
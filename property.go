@@ -0,0 +1,201 @@
+package ok
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Property checks a query against an oracle, a Go function computing the result of the query,
+// on random rows. Every case fills the table with the rows of the generator, the seed of the
+// generator plus the number of the case, and compares the rows of the query with the oracle in
+// their TabSeparated form, in order. A failing case is shrunk to a minimal set of rows that still
+// fails, reported as a CSV fixture.
+type Property struct {
+	// Table is "database.table" or a table of the connection database, it is truncated before every case.
+	Table string
+	// Generator generates the rows of every case, its column overrides must be pure, see ValueFunc.
+	Generator Generator
+	// Query should order its rows, e.g. "SELECT user, count() FROM events GROUP BY user ORDER BY user".
+	Query string
+	// Oracle returns the rows the query returns for the rows of the table, given by column name
+	// as the generator returned them: NULLs are nil, arrays are slices and AggregateFunction
+	// columns hold the arguments aggregated into a state.
+	Oracle func(rows []map[string]interface{}) [][]interface{}
+	// Cases is the number of cases, 100 by default. Generator.Rows defaults to 100.
+	Cases int
+}
+
+// AssertProperty runs the cases of the property and reports the first one that fails.
+func (c *clickhouse) AssertProperty(property Property) bool {
+	var (
+		database, table = c.splitName(property.Table)
+		cases           = property.Cases
+		generator       = property.Generator
+	)
+	if cases <= 0 {
+		cases = 100
+	}
+	if generator.Rows <= 0 {
+		generator.Rows = 100
+	}
+	columns, err := c.columnNames(database, table)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	types, err := c.columnTypes(database, table, columns)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	location, err := c.location()
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, quoteIdentifier(column))
+	}
+	check := func(rows [][]interface{}) (string, error) {
+		if _, err := c.conn.Exec("TRUNCATE TABLE " + database + "." + table); err != nil {
+			return "", err
+		}
+		if len(rows) != 0 {
+			var err error
+			if hasAggregateFunctions(types) {
+				err = c.copyThroughStaging(database, table, columns, types, flattenRows(rows))
+			} else {
+				err = c.insert("INSERT INTO "+database+"."+table+" ("+strings.Join(quoted, ", ")+") VALUES", flattenRows(rows))
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		return c.checkProperty(property, columns, rows, location), nil
+	}
+	seed := generator.Seed
+	for i := 0; i < cases; i++ {
+		generator.Seed = seed + int64(i)
+		rows, err := generateRows(columns, types, generator)
+		if err != nil {
+			c.test.Error(err)
+			return false
+		}
+		failure, err := check(rows)
+		switch {
+		case err != nil:
+			c.test.Errorf("an error occurred while loading the rows of seed %d: %v", generator.Seed, err)
+			return false
+		case len(failure) == 0:
+			continue
+		}
+		shrunk := shrinkRows(rows, func(rows [][]interface{}) bool {
+			if result, err := check(rows); err == nil && len(result) != 0 {
+				failure = result
+				return true
+			}
+			return false
+		})
+		c.test.Errorf("property failed for seed %d, shrunk from %d to %d rows: %s\n%s\nfixture (columns %s):\n%s",
+			generator.Seed, len(rows), len(shrunk), property.Query, failure, strings.Join(columns, ", "), csvFixture(types, shrunk, location),
+		)
+		return false
+	}
+	return true
+}
+
+// checkProperty runs the query on the loaded rows and describes how it differs from the oracle, if it does.
+// The DateTime values of the oracle are compared in the location, the server time zone.
+func (c *clickhouse) checkProperty(property Property, columns []string, rows [][]interface{}, location *time.Location) string {
+	types, actual, err := c.queryResult(rewriteQuery(property.Query, c.rewrite))
+	if err != nil {
+		return fmt.Sprintf("an error occurred while running the query: %v", err)
+	}
+	objects := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		object := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			object[column] = row[i]
+		}
+		objects = append(objects, object)
+	}
+	var expected [][]string
+	for _, row := range property.Oracle(objects) {
+		if len(row) != len(types) {
+			return fmt.Sprintf("the oracle returned %d columns, the query %d", len(row), len(types))
+		}
+		values := make([]string, 0, len(row))
+		for i, value := range row {
+			values = append(values, formatValue(types[i], inLocation(types[i], value, location), false))
+		}
+		expected = append(expected, values)
+	}
+	if e, a := joinRows(expected), joinRows(actual); e != a {
+		return diff(e, a)
+	}
+	return ""
+}
+
+func joinRows(rows [][]string) string {
+	var text strings.Builder
+	for _, row := range rows {
+		text.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	return text.String()
+}
+
+// shrinkRows removes chunks of rows, halving their size down to single rows, as long as the rows still fail.
+func shrinkRows(rows [][]interface{}, fails func([][]interface{}) bool) [][]interface{} {
+	for size := (len(rows) + 1) / 2; size > 0; size /= 2 {
+		for start := 0; start < len(rows); {
+			end := start + size
+			if end > len(rows) {
+				end = len(rows)
+			}
+			candidate := append(append(make([][]interface{}, 0, len(rows)-(end-start)), rows[:start]...), rows[end:]...)
+			if fails(candidate) {
+				rows = candidate
+				continue
+			}
+			start = end
+		}
+	}
+	return rows
+}
+
+// csvFixture formats the rows as a CSV fixture CopyFromCSVFile loads: NULLs are \N, AggregateFunction
+// columns hold their arguments, a tuple of arrays for functions with several arguments. DateTime values
+// are formatted in the location, the server time zone the fixture is parsed in.
+func csvFixture(types []string, rows [][]interface{}, location *time.Location) string {
+	var (
+		text   strings.Builder
+		writer = csv.NewWriter(&text)
+	)
+	for _, row := range rows {
+		fields := make([]string, 0, len(row))
+		for i, value := range row {
+			stagingTypes := []string{types[i]}
+			if f, ok := parseAggregateFunction(types[i]); ok {
+				stagingTypes, _ = f.staging(make([]string, len(f.arguments)))
+			}
+			switch v := value.(type) {
+			case string:
+				fields = append(fields, v)
+			case multiValue:
+				values := make([]string, 0, len(v))
+				for j, value := range v {
+					values = append(values, formatValue(stagingTypes[j], inLocation(stagingTypes[j], value, location), true))
+				}
+				fields = append(fields, "("+strings.Join(values, ",")+")")
+			default:
+				fields = append(fields, formatValue(stagingTypes[0], inLocation(stagingTypes[0], value, location), false))
+			}
+		}
+		writer.Write(fields)
+	}
+	writer.Flush()
+	return text.String()
+}
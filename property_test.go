@@ -0,0 +1,152 @@
+package ok
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShrinkRows(t *testing.T) {
+	var rows [][]interface{}
+	for i := 0; i < 100; i++ {
+		rows = append(rows, []interface{}{i})
+	}
+	var checks int
+	shrunk := shrinkRows(rows, func(rows [][]interface{}) bool {
+		checks++
+		var has13, has42 bool
+		for _, row := range rows {
+			has13 = has13 || row[0] == 13
+			has42 = has42 || row[0] == 42
+		}
+		return has13 && has42
+	})
+	assert.Equal(t, [][]interface{}{{13}, {42}}, shrunk)
+	assert.True(t, checks < 100, "checks %d", checks)
+	assert.Empty(t, shrinkRows(rows[:1], func([][]interface{}) bool { return true }))
+}
+
+func TestCSVFixture(t *testing.T) {
+	types := []string{
+		"UInt8", "String", "Date", "Nullable(Float64)", "Array(String)",
+		"AggregateFunction(uniq, UInt64)", "AggregateFunction(argMax, String, DateTime)",
+	}
+	rows := [][]interface{}{
+		{
+			uint8(1), "a,\"b\"", time.Date(2019, 2, 9, 0, 0, 0, 0, time.UTC), nil, []string{"x", "it's"},
+			[]uint64{1, 2}, multiValue{[]string{"a"}, []time.Time{time.Date(2019, 2, 9, 10, 10, 10, 0, time.UTC)}},
+		},
+	}
+	assert.Equal(t,
+		`1,"a,""b""",2019-02-09,\N,"['x','it\'s']","[1,2]","(['a'],['2019-02-09 10:10:10'])"`+"\n",
+		csvFixture(types, rows, time.UTC),
+	)
+}
+
+func TestCSVFixtureLoads(t *testing.T) {
+	var (
+		columns = []string{
+			"id", "value", "ratio", "name", "code", "day", "time", "uuid", "kind", "amount", "maybe",
+			"tags", "days", "scores", "users", "last", "total",
+		}
+		types = []string{
+			"UInt8", "Int64", "Float32", "String", "FixedString(3)", "Date", "DateTime", "UUID", "Enum8('a' = 1, 'it\\'s' = 2)", "Decimal(9, 2)", "Nullable(Int16)",
+			"Array(String)", "Array(Date)", "Array(Float64)", "AggregateFunction(uniq, UInt64)", "AggregateFunction(argMax, String, DateTime)", "SimpleAggregateFunction(sum, UInt64)",
+		}
+		last = indexOf(columns, "last")
+	)
+	rows, err := generateRows(columns, types, Generator{Rows: 200, Seed: 7})
+	if !assert.NoError(t, err) {
+		return
+	}
+	fixture := csvFixture(types, rows, time.UTC)
+	loaded, err := csvToArgs(types, strings.NewReader(fixture), ',', time.UTC)
+	if assert.NoError(t, err) && assert.Len(t, loaded, len(rows)) {
+		for i, row := range loaded {
+			// the arguments of argMax are loaded into two staging columns
+			loaded[i] = append(append(row[:last:last], multiValue{row[last], row[last+1]}), row[last+2:]...)
+		}
+		assert.Equal(t, fixture, csvFixture(types, loaded, time.UTC))
+	}
+}
+
+// errorRecorder records the errors reported to the test instead of failing it.
+type errorRecorder struct {
+	*testing.T
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestProperty(t *testing.T) {
+	recorder := errorRecorder{T: t}
+	clickhouse := Connect(&recorder, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	ddl := `
+		CREATE DATABASE property_tester;
+		CREATE TABLE property_tester.events (
+			user  String,
+			value Int32
+		) Engine Memory;
+	`
+	if !assert.NoError(t, clickhouse.Exec(ddl)) {
+		return
+	}
+	var (
+		users = OneOf("a", "b", "c")
+		total = func(rows []map[string]interface{}) [][]interface{} {
+			sums := make(map[string]int64)
+			for _, row := range rows {
+				sums[row["user"].(string)] += int64(row["value"].(int32))
+			}
+			var result [][]interface{}
+			for user, sum := range sums {
+				result = append(result, []interface{}{user, sum})
+			}
+			sort.Slice(result, func(i, j int) bool {
+				return result[i][0].(string) < result[j][0].(string)
+			})
+			return result
+		}
+	)
+	assert.True(t, clickhouse.AssertProperty(Property{
+		Table:     "property_tester.events",
+		Generator: Generator{Rows: 20, Columns: map[string]ValueFunc{"user": users}},
+		Query:     "SELECT user, sum(value) FROM property_tester.events GROUP BY user ORDER BY user",
+		Oracle:    total,
+		Cases:     10,
+	}))
+	assert.Empty(t, recorder.errors)
+	// the oracle misses the filter of the query, the rows with a 7 tell them apart
+	assert.False(t, clickhouse.AssertProperty(Property{
+		Table: "property_tester.events",
+		Generator: Generator{Rows: 20, Columns: map[string]ValueFunc{
+			"user":  users,
+			"value": func(r *rand.Rand, _ int) interface{} { return r.Intn(10) },
+		}},
+		Query: "SELECT count() FROM property_tester.events WHERE value != 7",
+		Oracle: func(rows []map[string]interface{}) [][]interface{} {
+			return [][]interface{}{{len(rows)}}
+		},
+		Cases: 10,
+	}))
+	if assert.Len(t, recorder.errors, 1) {
+		assert.Contains(t, recorder.errors[0], "shrunk from 20 to 1 rows")
+		assert.Regexp(t, "fixture \\(columns user, value\\):\n[abc],7\n$", recorder.errors[0])
+		fixture := recorder.errors[0][strings.LastIndex(recorder.errors[0], ":\n")+2:]
+		if assert.NoError(t, clickhouse.Exec("TRUNCATE TABLE property_tester.events")) &&
+			assert.True(t, clickhouse.CopyFromCSVReader(strings.NewReader(fixture), "INSERT INTO property_tester.events VALUES")) {
+			var value int32
+			if err := clickhouse.DB().QueryRow("SELECT value FROM property_tester.events").Scan(&value); assert.NoError(t, err) {
+				assert.Equal(t, int32(7), value)
+			}
+		}
+	}
+}
@@ -0,0 +1,717 @@
+package ok
+
+import (
+	"bufio"
+	"bytes"
+	le "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kshvakov/clickhouse/lib/binary"
+	"github.com/kshvakov/clickhouse/lib/column"
+	"github.com/kshvakov/clickhouse/lib/data"
+	"github.com/kshvakov/clickhouse/lib/lz4"
+	"github.com/kshvakov/clickhouse/lib/protocol"
+)
+
+// Protocol revisions that changed the client packets the proxy decodes.
+const (
+	revisionWithClientInfo            = 54032
+	revisionWithVersionPatch          = 54401
+	revisionWithSettingsAsStrings     = 54429
+	revisionWithInterserverSecret     = 54441
+	revisionWithOpenTelemetry         = 54442
+	revisionWithDistributedDepth      = 54448
+	revisionWithInitialQueryStartTime = 54449
+	revisionWithParallelReplicas      = 54453
+	revisionWithCustomSerialization   = 54454
+	revisionWithAddendum              = 54458
+	revisionWithParameters            = 54459
+	proxyMaxRevision                  = 54460
+	clientInfoInterfaceTCP            = 1
+)
+
+var (
+	// errPassthrough stops decoding a connection without reporting an error, e.g. when the server refused the hello.
+	errPassthrough = errors.New("passthrough")
+	// errDropped closes a connection on a fault.
+	errDropped = errors.New("dropped")
+)
+
+// ProxyQuery is a query a client sent through the proxy. Columns and Rows hold the data blocks
+// sent with the query, e.g. the rows of an INSERT.
+type ProxyQuery struct {
+	ID         string
+	Query      string
+	Settings   map[string]string
+	Parameters map[string]string
+	Columns    []string
+	Rows       [][]interface{}
+}
+
+// Proxy is a TCP proxy in front of the server that records the queries clients send through it
+// and injects the faults set with SetFaults. Traffic it cannot decode is forwarded as is and reported by Err.
+type Proxy struct {
+	test     T
+	dsn      string
+	target   string
+	listener net.Listener
+	mutex    sync.Mutex
+	queries  []*ProxyQuery
+	faults   []*Fault
+	conns    map[net.Conn]struct{}
+	err      error
+	wait     sync.WaitGroup
+}
+
+// Proxy starts a recording proxy to the server of the connection. Point the application
+// at Proxy().DSN() to capture the queries it sends. The proxy is closed by Clear.
+func (c *clickhouse) Proxy() *Proxy {
+	dsn, err := url.Parse(c.dsn)
+	if err != nil {
+		c.test.Fatalf("could not parse DSN: %v", err)
+	}
+	proxy, err := newProxy(c.test, dsn)
+	if err != nil {
+		c.test.Fatalf("could not start proxy: %v", err)
+	}
+	c.clear.proxies = append(c.clear.proxies, proxy)
+	return proxy
+}
+
+func newProxy(test T, dsn *url.URL) (*Proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	target := dsn.Host
+	dsn.Host = listener.Addr().String()
+	proxy := &Proxy{
+		test:     test,
+		dsn:      dsn.String(),
+		target:   target,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	proxy.wait.Add(1)
+	go proxy.serve()
+	return proxy, nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// DSN returns the DSN of the connection with the address of the proxy.
+func (p *Proxy) DSN() string {
+	return p.dsn
+}
+
+// Queries returns the queries captured since the proxy started or was reset.
+func (p *Proxy) Queries() []ProxyQuery {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	queries := make([]ProxyQuery, 0, len(p.queries))
+	for _, query := range p.queries {
+		queries = append(queries, *query)
+	}
+	return queries
+}
+
+// Reset forgets the captured queries and decoding errors.
+func (p *Proxy) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queries, p.err = nil, nil
+}
+
+// Err returns the first error that occurred while decoding the traffic.
+func (p *Proxy) Err() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+// Close stops the proxy and closes the connections through it.
+func (p *Proxy) Close() error {
+	err := p.listener.Close()
+	p.mutex.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mutex.Unlock()
+	p.wait.Wait()
+	return err
+}
+
+// AssertQueriesAtMost checks that no more than n queries were sent through the proxy.
+func (p *Proxy) AssertQueriesAtMost(n int) bool {
+	if !p.decoded() {
+		return false
+	}
+	if queries := p.Queries(); len(queries) > n {
+		p.test.Errorf("expected at most %d queries, got %d:\n%s", n, len(queries), formatQueries(queries))
+		return false
+	}
+	return true
+}
+
+// AssertQueryMatches checks that a query sent through the proxy matches the regular expression,
+// e.g. `(?i)\bPREWHERE\b`.
+func (p *Proxy) AssertQueryMatches(pattern string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		p.test.Errorf("invalid pattern: %v", err)
+		return false
+	}
+	if !p.decoded() {
+		return false
+	}
+	queries := p.Queries()
+	for _, query := range queries {
+		if re.MatchString(query.Query) {
+			return true
+		}
+	}
+	p.test.Errorf("no query matches '%s':\n%s", pattern, formatQueries(queries))
+	return false
+}
+
+func (p *Proxy) decoded() bool {
+	if err := p.Err(); err != nil {
+		p.test.Errorf("the proxy could not decode the traffic: %v", err)
+		return false
+	}
+	return true
+}
+
+func formatQueries(queries []ProxyQuery) string {
+	var out strings.Builder
+	for i, query := range queries {
+		fmt.Fprintf(&out, "%d: %s\n", i+1, query.Query)
+	}
+	return out.String()
+}
+
+func (p *Proxy) serve() {
+	defer p.wait.Done()
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		server, err := net.DialTimeout("tcp", p.target, 5*time.Second)
+		if err != nil {
+			p.fail(fmt.Errorf("could not connect to %s: %v", p.target, err))
+			client.Close()
+			continue
+		}
+		p.mutex.Lock()
+		p.conns[client], p.conns[server] = struct{}{}, struct{}{}
+		p.mutex.Unlock()
+		p.wait.Add(1)
+		go p.forward(client, server)
+	}
+}
+
+// proxyConn is a connection through the proxy. The client packets are read into packet
+// and sent to the server once decoded, so faults can change or drop them.
+type proxyConn struct {
+	client   *lockedWriter
+	server   *bufio.Writer
+	packet   bytes.Buffer
+	query    *ProxyQuery
+	compress bool
+	// skip drops the data of a query the proxy answered itself, until the next packet of another kind.
+	skip   bool
+	counts map[*Fault]int
+}
+
+// forward copies the traffic of the connection in both directions, decoding the client packets.
+// The connection is closed when either side closes it.
+func (p *Proxy) forward(client, server net.Conn) {
+	defer p.wait.Done()
+	var (
+		serverInfo = make(chan *data.ServerInfo, 1)
+		done       = make(chan struct{})
+		closeBoth  = func() {
+			client.Close()
+			server.Close()
+			p.mutex.Lock()
+			delete(p.conns, client)
+			delete(p.conns, server)
+			p.mutex.Unlock()
+		}
+		conn = proxyConn{
+			client: &lockedWriter{writer: client},
+			server: bufio.NewWriter(server),
+			counts: make(map[*Fault]int),
+		}
+	)
+	go func() {
+		defer close(done)
+		defer closeBoth()
+		readServerHello(server, conn.client, serverInfo)
+	}()
+	var (
+		reader = bufio.NewReader(client)
+		input  = &fullReader{reader: io.TeeReader(reader, &conn.packet)}
+	)
+	err := p.readClient(&conn, input, serverInfo)
+	if err != nil && err != errDropped && input.err == nil {
+		if err != errPassthrough {
+			p.fail(err)
+		}
+		conn.server.Write(conn.packet.Bytes())
+		conn.server.Flush()
+		io.Copy(server, reader)
+	}
+	closeBoth()
+	<-done
+}
+
+// readServerHello passes the server traffic to the client, decoding the server hello on the way.
+func readServerHello(server net.Conn, client io.Writer, serverInfo chan<- *data.ServerInfo) {
+	var (
+		reader  = bufio.NewReader(server)
+		decoder = binary.NewDecoder(&fullReader{reader: io.TeeReader(reader, client)})
+	)
+	if packet, err := decoder.Uvarint(); err == nil && packet == protocol.ServerHello {
+		var info data.ServerInfo
+		if err := info.Read(decoder); err == nil {
+			serverInfo <- &info
+		}
+	}
+	close(serverInfo)
+	io.Copy(client, reader)
+}
+
+func (p *Proxy) readClient(conn *proxyConn, input io.Reader, serverInfo <-chan *data.ServerInfo) error {
+	decoder := binary.NewDecoder(input)
+	packet, err := decoder.Uvarint()
+	switch {
+	case err != nil:
+		return err
+	case packet != protocol.ClientHello:
+		return fmt.Errorf("unexpected packet %d instead of the client hello", packet)
+	}
+	revision, err := readClientHello(decoder)
+	if err != nil {
+		return err
+	}
+	if err := conn.flush(); err != nil {
+		return err
+	}
+	info, ok := <-serverInfo
+	if !ok {
+		return errPassthrough
+	}
+	if info.Revision < revision {
+		revision = info.Revision
+	}
+	if info.Timezone == nil {
+		info.Timezone = time.UTC
+	}
+	if revision > proxyMaxRevision {
+		return fmt.Errorf("protocol revision %d is not supported", revision)
+	}
+	if revision >= revisionWithAddendum {
+		if _, err := decoder.String(); err != nil {
+			return err
+		}
+		if err := conn.flush(); err != nil {
+			return err
+		}
+	}
+	for {
+		packet, err := decoder.Uvarint()
+		if err != nil {
+			return err
+		}
+		block, rows := -1, 0
+		if packet != protocol.ClientData {
+			conn.skip = false
+		}
+		switch packet {
+		case protocol.ClientQuery:
+			if conn.query, conn.compress, err = readQuery(decoder, revision); err != nil {
+				return err
+			}
+			p.mutex.Lock()
+			p.queries = append(p.queries, conn.query)
+			p.mutex.Unlock()
+		case protocol.ClientData:
+			if _, err := decoder.String(); err != nil { // temporary table name
+				return err
+			}
+			block = conn.packet.Len()
+			columns, values, err := readBlock(decoder, input, info, revision, conn.compress)
+			if err != nil {
+				return err
+			}
+			if rows = len(values); conn.query != nil && rows != 0 {
+				p.mutex.Lock()
+				conn.query.Columns = columns
+				conn.query.Rows = append(conn.query.Rows, values...)
+				p.mutex.Unlock()
+			}
+		case protocol.ClientCancel, protocol.ClientPing:
+		default:
+			return fmt.Errorf("unknown client packet %d", packet)
+		}
+		if err := p.send(conn, packet, block, rows); err != nil {
+			return err
+		}
+	}
+}
+
+// flush sends the packet read to the server.
+func (conn *proxyConn) flush() error {
+	defer conn.packet.Reset()
+	if _, err := conn.server.Write(conn.packet.Bytes()); err != nil {
+		return err
+	}
+	return conn.server.Flush()
+}
+
+func (p *Proxy) fail(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// readClientHello reads the hello after the packet type and returns the client revision.
+func readClientHello(decoder *binary.Decoder) (revision uint64, err error) {
+	if _, err = decoder.String(); err != nil { // client name
+		return 0, err
+	}
+	for _, field := range []*uint64{new(uint64), new(uint64), &revision} { // major, minor, revision
+		if *field, err = decoder.Uvarint(); err != nil {
+			return 0, err
+		}
+	}
+	for i := 0; i < 3; i++ { // database, user, password
+		if _, err = decoder.String(); err != nil {
+			return 0, err
+		}
+	}
+	return revision, nil
+}
+
+func readQuery(decoder *binary.Decoder, revision uint64) (_ *ProxyQuery, compress bool, err error) {
+	query := ProxyQuery{}
+	if query.ID, err = decoder.String(); err != nil {
+		return nil, false, err
+	}
+	if revision >= revisionWithClientInfo {
+		if err = readClientInfo(decoder, revision); err != nil {
+			return nil, false, err
+		}
+	}
+	if query.Settings, err = readSettings(decoder, revision); err != nil {
+		return nil, false, err
+	}
+	if revision >= revisionWithInterserverSecret {
+		if _, err = decoder.String(); err != nil {
+			return nil, false, err
+		}
+	}
+	if _, err = decoder.Uvarint(); err != nil { // stage
+		return nil, false, err
+	}
+	compression, err := decoder.Uvarint()
+	if err != nil {
+		return nil, false, err
+	}
+	if query.Query, err = decoder.String(); err != nil {
+		return nil, false, err
+	}
+	if revision >= revisionWithParameters {
+		if query.Parameters, err = readSettings(decoder, revision); err != nil {
+			return nil, false, err
+		}
+	}
+	return &query, compression == protocol.CompressEnable, nil
+}
+
+func readClientInfo(decoder *binary.Decoder, revision uint64) error {
+	kind, err := decoder.UInt8()
+	if err != nil || kind == 0 {
+		return err
+	}
+	for i := 0; i < 3; i++ { // initial user, initial query id, initial address
+		if _, err := decoder.String(); err != nil {
+			return err
+		}
+	}
+	if revision >= revisionWithInitialQueryStartTime {
+		if _, err := decoder.Int64(); err != nil {
+			return err
+		}
+	}
+	iface, err := decoder.UInt8()
+	if err != nil {
+		return err
+	}
+	if iface != clientInfoInterfaceTCP {
+		return fmt.Errorf("unsupported client interface %d", iface)
+	}
+	for i := 0; i < 3; i++ { // OS user, hostname, client name
+		if _, err := decoder.String(); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < 3; i++ { // major, minor, revision
+		if _, err := decoder.Uvarint(); err != nil {
+			return err
+		}
+	}
+	if revision >= protocol.DBMS_MIN_REVISION_WITH_QUOTA_KEY_IN_CLIENT_INFO {
+		if _, err := decoder.String(); err != nil {
+			return err
+		}
+	}
+	if revision >= revisionWithDistributedDepth {
+		if _, err := decoder.Uvarint(); err != nil {
+			return err
+		}
+	}
+	if revision >= revisionWithVersionPatch {
+		if _, err := decoder.Uvarint(); err != nil {
+			return err
+		}
+	}
+	if revision >= revisionWithOpenTelemetry {
+		trace, err := decoder.UInt8()
+		if err != nil {
+			return err
+		}
+		if trace == 1 {
+			if _, err := decoder.Fixed(16 + 8); err != nil { // trace id, span id
+				return err
+			}
+			if _, err := decoder.String(); err != nil { // trace state
+				return err
+			}
+			if _, err := decoder.UInt8(); err != nil { // trace flags
+				return err
+			}
+		}
+	}
+	if revision >= revisionWithParallelReplicas {
+		for i := 0; i < 3; i++ {
+			if _, err := decoder.Uvarint(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readSettings reads settings serialized as strings, a list of name, flags and value ended by an empty name.
+// Older revisions serialize the values in their binary types, only an empty list can be read then.
+func readSettings(decoder *binary.Decoder, revision uint64) (map[string]string, error) {
+	settings := make(map[string]string)
+	for {
+		name, err := decoder.String()
+		switch {
+		case err != nil:
+			return nil, err
+		case len(name) == 0:
+			return settings, nil
+		case revision < revisionWithSettingsAsStrings:
+			return nil, fmt.Errorf("settings of protocol revision %d cannot be decoded", revision)
+		}
+		if _, err := decoder.Uvarint(); err != nil { // flags
+			return nil, err
+		}
+		if settings[name], err = decoder.String(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readBlock reads the block of a data packet and returns its columns and rows.
+// Compressed blocks are read from the frames that follow in the input.
+func readBlock(decoder *binary.Decoder, input io.Reader, info *data.ServerInfo, revision uint64, compress bool) ([]string, [][]interface{}, error) {
+	if compress {
+		decoder = binary.NewDecoder(&frameReader{reader: input})
+	}
+	if err := readBlockInfo(decoder); err != nil {
+		return nil, nil, err
+	}
+	numColumns, err := decoder.Uvarint()
+	if err != nil {
+		return nil, nil, err
+	}
+	numRows, err := decoder.Uvarint()
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		columns = make([]string, 0, numColumns)
+		rows    = make([][]interface{}, numRows)
+	)
+	for i := 0; i < int(numColumns); i++ {
+		name, err := decoder.String()
+		if err != nil {
+			return nil, nil, err
+		}
+		columnType, err := decoder.String()
+		if err != nil {
+			return nil, nil, err
+		}
+		if revision >= revisionWithCustomSerialization {
+			custom, err := decoder.UInt8()
+			if err != nil {
+				return nil, nil, err
+			}
+			if custom != 0 {
+				return nil, nil, fmt.Errorf("column '%s' uses a custom serialization", name)
+			}
+		}
+		values, err := readColumn(decoder, name, columnType, info.Timezone, int(numRows))
+		if err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, name)
+		for row, value := range values {
+			rows[row] = append(rows[row], value)
+		}
+	}
+	return columns, rows, nil
+}
+
+func readBlockInfo(decoder *binary.Decoder) error {
+	for {
+		field, err := decoder.Uvarint()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 0:
+			return nil
+		case 1: // is overflows
+			_, err = decoder.Bool()
+		case 2: // bucket number
+			_, err = decoder.Int32()
+		default:
+			return fmt.Errorf("unknown block info field %d", field)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readColumn(decoder *binary.Decoder, name, columnType string, timezone *time.Location, rows int) ([]interface{}, error) {
+	c, err := column.Factory(name, columnType, timezone)
+	if err != nil {
+		return nil, err
+	}
+	switch c := c.(type) {
+	case *column.Array:
+		return c.ReadArray(decoder, rows)
+	case *column.Nullable:
+		return c.ReadNull(decoder, rows)
+	}
+	values := make([]interface{}, 0, rows)
+	for row := 0; row < rows; row++ {
+		value, err := c.Read(decoder)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// frameReader decompresses the frames of a compressed block: a checksum, the method,
+// the compressed size including the 9 header bytes, the decompressed size and the data.
+// Frames are read only when the buffered data runs out, so it stops at the end of the block.
+type frameReader struct {
+	reader io.Reader
+	data   []byte
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if len(r.data) == 0 {
+			if err := r.readFrame(); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p[n:], r.data)
+		r.data, n = r.data[copied:], n+copied
+	}
+	return n, nil
+}
+
+func (r *frameReader) readFrame() error {
+	header := make([]byte, binary.HeaderSize)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return err
+	}
+	var (
+		method           = header[binary.ChecksumSize]
+		compressedSize   = int(le.LittleEndian.Uint32(header[binary.ChecksumSize+1:])) - binary.CompressHeaderSize
+		decompressedSize = int(le.LittleEndian.Uint32(header[binary.ChecksumSize+5:]))
+	)
+	if compressedSize < 0 {
+		return fmt.Errorf("invalid compressed frame size %d", compressedSize)
+	}
+	compressed := make([]byte, compressedSize)
+	if _, err := io.ReadFull(r.reader, compressed); err != nil {
+		return err
+	}
+	switch method {
+	case byte(binary.NONE):
+		r.data = compressed
+	case binary.LZ4:
+		r.data = make([]byte, decompressedSize)
+		if _, err := lz4.Decode(r.data, compressed); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown compression method 0x%x", method)
+	}
+	return nil
+}
+
+// lockedWriter serializes the writes of the server traffic and of the packets the proxy sends itself.
+type lockedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(p)
+}
+
+// fullReader fills the buffers the decoder reads into, the codecs expect complete reads.
+// It keeps the read error to tell a closed connection from a decoding error.
+type fullReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *fullReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(r.reader, p)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,178 @@
+package ok
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kshvakov/clickhouse/lib/binary"
+	"github.com/kshvakov/clickhouse/lib/column"
+	"github.com/kshvakov/clickhouse/lib/data"
+	"github.com/kshvakov/clickhouse/lib/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer answers the hello of the vendored driver's revision and returns everything it received.
+func fakeServer(t *testing.T) (string, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []byte, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		encoder := binary.NewEncoder(conn)
+		encoder.Uvarint(protocol.ServerHello)
+		encoder.String("ClickHouse")
+		encoder.Uvarint(19)
+		encoder.Uvarint(1)
+		encoder.Uvarint(54213)
+		encoder.String("UTC")
+		data, _ := ioutil.ReadAll(conn)
+		received <- data
+	}()
+	return listener.Addr().String(), received
+}
+
+// dialProxy connects to the proxy and exchanges the hello. The packets written with the encoder
+// are kept in the buffer.
+func dialProxy(t *testing.T, proxy *Proxy) (net.Conn, *binary.Encoder, *bytes.Buffer) {
+	conn, err := net.Dial("tcp", proxy.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		sent    bytes.Buffer
+		encoder = binary.NewEncoder(io.MultiWriter(conn, &sent))
+	)
+	encoder.Uvarint(protocol.ClientHello)
+	encoder.String("Golang SQLDriver")
+	encoder.Uvarint(1)
+	encoder.Uvarint(1)
+	encoder.Uvarint(54213)
+	for _, value := range []string{"default", "default", ""} {
+		encoder.String(value)
+	}
+	hello := make([]byte, 21)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		t.Fatal(err)
+	}
+	return conn, encoder, &sent
+}
+
+// writeQuery writes a query and a data block the way the vendored driver does.
+func writeQuery(t *testing.T, encoder *binary.Encoder, query string, compress bool) {
+	writeQueryPacket(encoder, query, compress)
+	writeBlock(t, encoder, compress)
+}
+
+func writeQueryPacket(encoder *binary.Encoder, query string, compress bool) {
+	encoder.Uvarint(protocol.ClientQuery)
+	encoder.String("query-1")
+	encoder.Uvarint(1)
+	for _, value := range []string{"", "", "[::ffff:127.0.0.1]:0"} {
+		encoder.String(value)
+	}
+	encoder.Uvarint(1)
+	for _, value := range []string{"tester", "localhost", "Golang SQLDriver"} {
+		encoder.String(value)
+	}
+	encoder.Uvarint(1)
+	encoder.Uvarint(1)
+	encoder.Uvarint(54213)
+	encoder.String("")
+	encoder.String("")
+	encoder.Uvarint(protocol.StateComplete)
+	if compress {
+		encoder.Uvarint(protocol.CompressEnable)
+	} else {
+		encoder.Uvarint(0)
+	}
+	encoder.String(query)
+}
+
+func writeBlock(t *testing.T, encoder *binary.Encoder, compress bool) {
+	var block data.Block
+	for _, c := range [][]string{{"id", "UInt64"}, {"tags", "Array(String)"}} {
+		column, err := column.Factory(c[0], c[1], time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Columns = append(block.Columns, column)
+	}
+	block.NumColumns = 2
+	for _, row := range [][]driver.Value{{uint64(1), []string{"a"}}, {uint64(2), []string{"b", "c"}}} {
+		if err := block.AppendRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encoder.Uvarint(protocol.ClientData)
+	encoder.String("")
+	encoder.SelectCompress(compress)
+	if err := block.Write(&data.ServerInfo{}, encoder); err != nil {
+		t.Fatal(err)
+	}
+	encoder.SelectCompress(false)
+}
+
+func TestProxyDecode(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		address, received := fakeServer(t)
+		proxy, err := newProxy(t, &url.URL{Scheme: "tcp", Host: address, RawQuery: "debug=0"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "tcp://"+proxy.Addr()+"?debug=0", proxy.DSN())
+		conn, encoder, sent := dialProxy(t, proxy)
+		writeQuery(t, encoder, "SELECT * FROM t PREWHERE id = 1", compress)
+		encoder.Uvarint(protocol.ClientPing)
+		conn.Close()
+		if assert.Equal(t, sent.Bytes(), <-received) && assert.NoError(t, proxy.Err()) {
+			assert.Equal(t, []ProxyQuery{
+				{
+					ID:       "query-1",
+					Query:    "SELECT * FROM t PREWHERE id = 1",
+					Settings: map[string]string{},
+					Columns:  []string{"id", "tags"},
+					Rows: [][]interface{}{
+						{uint64(1), []string{"a"}},
+						{uint64(2), []string{"b", "c"}},
+					},
+				},
+			}, proxy.Queries())
+			assert.True(t, proxy.AssertQueriesAtMost(1))
+			assert.True(t, proxy.AssertQueryMatches(`(?i)\bPREWHERE\b`))
+		}
+		proxy.Reset()
+		assert.Empty(t, proxy.Queries())
+		assert.NoError(t, proxy.Close())
+	}
+}
+
+func TestProxy(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	proxy := clickhouse.Proxy()
+	app, err := sql.Open("clickhouse", proxy.DSN())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer app.Close()
+	var count uint64
+	if err := app.QueryRow("SELECT count() FROM (SELECT number FROM system.numbers PREWHERE number < 10 LIMIT 10)").Scan(&count); assert.NoError(t, err) {
+		assert.True(t, proxy.AssertQueriesAtMost(1))
+		assert.True(t, proxy.AssertQueryMatches(`(?i)\bPREWHERE\b`))
+	}
+}
@@ -0,0 +1,163 @@
+package ok
+
+import (
+	"fmt"
+	"time"
+)
+
+// QueryLogEntry is a query of the connection logged in system.query_log.
+type QueryLogEntry struct {
+	QueryID     string
+	Query       string
+	ReadRows    uint64
+	ReadBytes   uint64
+	WrittenRows uint64
+	ResultRows  uint64
+	MemoryUsage uint64
+	Duration    time.Duration
+	Exception   string
+}
+
+// QueriesExecuted flushes the logs and returns the queries the connection ran during the test in the order
+// they finished, the queries of the helpers included. Connect tags the queries with a log_comment per test,
+// which needs ClickHouse 20.5 or later.
+func (c *clickhouse) QueriesExecuted() ([]QueryLogEntry, error) {
+	return c.queryLog("")
+}
+
+// AssertReadRowsAtMost runs the query and checks that it read no more than the number of rows,
+// e.g. to check that the partitions or the primary key prune the parts read.
+func (c *clickhouse) AssertReadRowsAtMost(query string, rows uint64) bool {
+	entry, err := c.measure(query)
+	if err != nil {
+		c.test.Errorf("an error occurred while measuring the query: %v", err)
+		return false
+	}
+	if entry.ReadRows > rows {
+		c.test.Errorf("the query read %d rows, expected at most %d: %s", entry.ReadRows, rows, query)
+		return false
+	}
+	return true
+}
+
+// AssertMemoryUsageBelow runs the query and checks that its peak memory usage stays below the number of bytes.
+func (c *clickhouse) AssertMemoryUsageBelow(query string, bytes uint64) bool {
+	entry, err := c.measure(query)
+	if err != nil {
+		c.test.Errorf("an error occurred while measuring the query: %v", err)
+		return false
+	}
+	if entry.MemoryUsage >= bytes {
+		c.test.Errorf("the query used %d bytes of memory, expected less than %d: %s", entry.MemoryUsage, bytes, query)
+		return false
+	}
+	return true
+}
+
+// AssertUsedIndex checks that the query uses the primary key of the MergeTree tables it reads
+// by running it with force_primary_key.
+func (c *clickhouse) AssertUsedIndex(query string) bool {
+	var err error
+	if !c.Settings(map[string]interface{}{"force_primary_key": 1}, func() {
+		err = c.drain(rewriteQuery(query, c.rewrite))
+	}) {
+		return false
+	}
+	if err == nil {
+		return true
+	}
+	if code, _ := errorCode(err); code == IndexNotUsed {
+		c.test.Errorf("the query does not use the primary key: %s", query)
+	} else {
+		c.test.Errorf("an error occurred while running the query: %v", err)
+	}
+	return false
+}
+
+// measure runs the query and returns its entry in the query log. A comment with the time
+// tells the run apart from previous runs of the same query.
+func (c *clickhouse) measure(query string) (*QueryLogEntry, error) {
+	prefix := fmt.Sprintf("/* ok:%d */", time.Now().UnixNano())
+	if err := c.drain(prefix + " " + rewriteQuery(query, c.rewrite)); err != nil {
+		return nil, err
+	}
+	entries, err := c.queryLog(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("the query is not in system.query_log, is log_queries disabled for the user?")
+	}
+	return &entries[len(entries)-1], nil
+}
+
+// drain runs the query and reads the rows it returns.
+func (c *clickhouse) drain(query string) error {
+	rows, err := c.conn.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// queryLog flushes the logs and returns the finished queries of the connection, only the ones starting with the prefix if set.
+func (c *clickhouse) queryLog(prefix string) ([]QueryLogEntry, error) {
+	if _, err := c.conn.Exec("SYSTEM FLUSH LOGS"); err != nil {
+		return nil, err
+	}
+	if !c.settings.tagged() {
+		return nil, fmt.Errorf("the server has no log_comment setting, the queries of the test cannot be found in system.query_log")
+	}
+	var (
+		args  = []interface{}{c.settings.tag}
+		where = "log_comment = ? AND type != 'QueryStart' AND event_date >= yesterday()"
+	)
+	if len(prefix) != 0 {
+		where += " AND startsWith(query, ?)"
+		args = append(args, prefix)
+	}
+	rows, err := c.conn.Query(`
+		SELECT
+			query_id,
+			query,
+			read_rows,
+			read_bytes,
+			written_rows,
+			result_rows,
+			memory_usage,
+			query_duration_ms,
+			exception
+		FROM system.query_log
+		WHERE `+where+`
+		ORDER BY event_time, query_start_time`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []QueryLogEntry
+	for rows.Next() {
+		var (
+			entry    QueryLogEntry
+			duration uint64
+		)
+		if err := rows.Scan(
+			&entry.QueryID,
+			&entry.Query,
+			&entry.ReadRows,
+			&entry.ReadBytes,
+			&entry.WrittenRows,
+			&entry.ResultRows,
+			&entry.MemoryUsage,
+			&duration,
+			&entry.Exception,
+		); err != nil {
+			return nil, err
+		}
+		entry.Duration = time.Duration(duration) * time.Millisecond
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,49 @@
+package ok
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagging(t *testing.T) {
+	settings := connSettings{tag: "ok:TestTagging:1"}
+	assert.Equal(t, []Setting{
+		{Name: "log_queries", Value: "1"},
+		{Name: "log_comment", Value: "'ok:TestTagging:1'"},
+	}, settings.tagging())
+	settings.untag()
+	assert.False(t, settings.tagged())
+	assert.Equal(t, []Setting{{Name: "log_queries", Value: "1"}}, settings.tagging())
+}
+
+func TestQueryLog(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	clickhouse.RequireSetting("log_comment")
+	ddl := `
+		CREATE DATABASE query_log_tester;
+		CREATE TABLE query_log_tester.events (
+			event_date Date,
+			id         UInt64
+		) Engine MergeTree PARTITION BY event_date ORDER BY id SETTINGS index_granularity = 8;
+		INSERT INTO query_log_tester.events SELECT toDate('2020-01-01') + number % 4, number FROM system.numbers LIMIT 1000;
+	`
+	if !assert.NoError(t, clickhouse.Exec(ddl)) {
+		return
+	}
+	assert.True(t, clickhouse.AssertReadRowsAtMost("SELECT count() FROM query_log_tester.events WHERE event_date = '2020-01-01'", 250))
+	assert.True(t, clickhouse.AssertReadRowsAtMost("SELECT * FROM query_log_tester.events WHERE id = 42", 8*4))
+	assert.True(t, clickhouse.AssertMemoryUsageBelow("SELECT * FROM query_log_tester.events WHERE id = 42", 100<<20))
+	assert.True(t, clickhouse.AssertUsedIndex("SELECT * FROM query_log_tester.events WHERE id = 42"))
+	if queries, err := clickhouse.QueriesExecuted(); assert.NoError(t, err) {
+		var found bool
+		for _, query := range queries {
+			if strings.HasPrefix(strings.TrimSpace(query.Query), "INSERT INTO query_log_tester.events") {
+				found = query.WrittenRows == 1000
+			}
+		}
+		assert.True(t, found)
+	}
+}
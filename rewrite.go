@@ -0,0 +1,202 @@
+package ok
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rewrite selects the changes Exec and ExecFromFile make to statements before sending them
+// to the server. It lets production DDL written for a cluster run on a single test server.
+type Rewrite int
+
+const (
+	// RewriteOnCluster strips ON CLUSTER clauses.
+	RewriteOnCluster Rewrite = 1 << iota
+	// RewriteReplicated maps Replicated*MergeTree engines to their non-replicated equivalents.
+	RewriteReplicated
+	// RewriteDistributed replaces Distributed engines with a Merge engine reading the local table only.
+	// Like a Distributed table over a single shard it returns the rows of the local table, but it
+	// does not accept inserts, the tests insert into the local table.
+	RewriteDistributed
+	// RewriteMemory replaces MergeTree family engines with Memory for speed.
+	RewriteMemory
+	// RewriteCluster combines the rewrites needed to run cluster DDL on a single server.
+	RewriteCluster = RewriteOnCluster | RewriteReplicated | RewriteDistributed
+)
+
+func (c *clickhouse) SetRewrite(rewrite Rewrite) {
+	c.rewrite = rewrite
+}
+
+type edit struct {
+	from, to int
+	text     string
+}
+
+// rewriteQuery applies the rewrites to a single statement. Statements the lexer
+// cannot handle are returned unchanged and left to the server to report.
+func rewriteQuery(query string, rewrite Rewrite) string {
+	if rewrite == 0 {
+		return query
+	}
+	tokens, err := lex(query)
+	if err != nil {
+		return query
+	}
+	var (
+		edits []edit
+		depth int
+	)
+	for i := 0; i < len(tokens); i++ {
+		switch tok := tokens[i]; {
+		case tok.is("(") || tok.is("["):
+			depth++
+		case tok.is(")") || tok.is("]"):
+			depth--
+		case depth != 0:
+		case rewrite&RewriteOnCluster != 0 && i != 0 && tok.isKeyword("ON") && i+2 < len(tokens) && tokens[i+1].isKeyword("CLUSTER"):
+			edits = append(edits, edit{from: tokens[i-1].end, to: tokens[i+2].end})
+			i += 2
+		case tok.isKeyword("ENGINE"):
+			if e, ok := rewriteEngine(query, tokens, i, rewrite); ok {
+				edits = append(edits, e...)
+			}
+		}
+	}
+	if len(edits) == 0 {
+		return query
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].from > edits[j].from
+	})
+	for i, e := range edits {
+		if i != 0 && e.to > edits[i-1].from {
+			e.to = edits[i-1].from
+		}
+		query = query[:e.from] + e.text + query[e.to:]
+	}
+	return query
+}
+
+func rewriteEngine(query string, tokens []token, start int, rewrite Rewrite) ([]edit, bool) {
+	p := parser{src: query, tokens: tokens, pos: start + 1}
+	p.accept("=")
+	i := p.pos
+	if p.peek().kind != tokenIdent {
+		return nil, false
+	}
+	engine, err := p.engine()
+	if err != nil {
+		return nil, false
+	}
+	engineTo := tokens[p.pos-1].end
+	switch {
+	case rewrite&RewriteReplicated != 0 && strings.HasPrefix(engine.Name, "Replicated") && strings.HasSuffix(engine.Name, "MergeTree"):
+		engine.Name = strings.TrimPrefix(engine.Name, "Replicated")
+		if len(engine.Args) >= 2 {
+			engine.Args = engine.Args[2:]
+		} else {
+			engine.Args = nil
+		}
+	case rewrite&RewriteDistributed != 0 && engine.Name == "Distributed" && len(engine.Args) >= 3:
+		table, err := lex(engine.Args[2])
+		if len(engine.Args[1]) == 0 || err != nil || len(table) != 1 || table[0].kind == tokenNumber || table[0].kind == tokenPunct {
+			return nil, false
+		}
+		return []edit{{
+			from: tokens[i].pos,
+			to:   engineTo,
+			text: "Merge(" + engine.Args[1] + ", " + quote("^"+regexp.QuoteMeta(table[0].value())+"$") + ")",
+		}}, true
+	}
+	if rewrite&RewriteMemory != 0 && strings.HasSuffix(engine.Name, "MergeTree") {
+		edits := []edit{{from: tokens[i].pos, to: engineClausesEnd(tokens, i), text: "Memory"}}
+		return append(edits, memoryElements(tokens, start)...), true
+	}
+	if engine.Name == tokens[i].text {
+		return nil, false
+	}
+	return []edit{{from: tokens[i].pos, to: engineTo, text: engine.String()}}, true
+}
+
+// engineClausesEnd returns the offset where the storage clauses following
+// the engine name end: at AS SELECT, POPULATE, COMMENT or the end of the statement.
+func engineClausesEnd(tokens []token, engine int) int {
+	var (
+		depth int
+		end   = tokens[engine].end
+	)
+	for i := engine + 1; i < len(tokens); i++ {
+		switch tok := tokens[i]; {
+		case tok.is("(") || tok.is("["):
+			depth++
+		case tok.is(")") || tok.is("]"):
+			depth--
+		case depth == 0 && (tok.is(";") || tok.isKeyword("AS") || tok.isKeyword("POPULATE") || tok.isKeyword("COMMENT")):
+			return end
+		}
+		end = tokens[i].end
+	}
+	return end
+}
+
+// memoryElements removes the parts of the column list that only MergeTree
+// tables support: data skipping indexes, projections and column TTLs.
+func memoryElements(tokens []token, engine int) (edits []edit) {
+	open := -1
+	for i := 0; i < engine; i++ {
+		if tokens[i].is("(") {
+			open = i
+			break
+		}
+		if tokens[i].isKeyword("AS") {
+			return nil
+		}
+	}
+	if open == -1 {
+		return nil
+	}
+	var (
+		depth     int
+		element   = open + 1
+		separator = open
+	)
+	for i := open + 1; i < engine; i++ {
+		tok := tokens[i]
+		switch {
+		case tok.is("(") || tok.is("["):
+			depth++
+			continue
+		case depth != 0 && (tok.is(")") || tok.is("]")):
+			depth--
+			continue
+		case depth != 0:
+			continue
+		case tok.is(",") || tok.is(")"):
+			if first := tokens[element]; first.isKeyword("INDEX") || first.isKeyword("PROJECTION") {
+				if tokens[separator].is("(") {
+					end := tokens[i-1].end
+					if tok.is(",") {
+						end = tokens[i+1].pos
+					}
+					edits = append(edits, edit{from: tokens[element].pos, to: end})
+				} else {
+					edits = append(edits, edit{from: tokens[separator].pos, to: tokens[i-1].end})
+				}
+			} else {
+				for j := element; j < i; j++ {
+					if tokens[j].isKeyword("TTL") {
+						edits = append(edits, edit{from: tokens[j-1].end, to: tokens[i-1].end})
+						break
+					}
+				}
+			}
+			if tok.is(")") {
+				return edits
+			}
+			element, separator = i+1, i
+		}
+	}
+	return edits
+}
@@ -0,0 +1,131 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Distributed tables become Merge tables over their local table rather than Buffer tables or views:
+// Merge keeps the columns of the CREATE TABLE ... AS statement and reads the local table with its
+// indexes. Merge tables do not accept inserts, tests insert into the local table instead.
+func TestRewriteQuery(t *testing.T) {
+	assets := []struct {
+		rewrite  Rewrite
+		src      string
+		expected string
+	}{
+		{
+			rewrite:  RewriteCluster,
+			src:      "CREATE DATABASE db ON CLUSTER '{cluster}'",
+			expected: "CREATE DATABASE db",
+		},
+		{
+			rewrite:  RewriteCluster,
+			src:      "ALTER TABLE db.t ON CLUSTER main DELETE WHERE 1",
+			expected: "ALTER TABLE db.t DELETE WHERE 1",
+		},
+		{
+			rewrite:  RewriteOnCluster,
+			src:      "CREATE TABLE db.t ON CLUSTER main (a UInt8) ENGINE = ReplicatedMergeTree('/tables/{shard}/t', '{replica}') ORDER BY a",
+			expected: "CREATE TABLE db.t (a UInt8) ENGINE = ReplicatedMergeTree('/tables/{shard}/t', '{replica}') ORDER BY a",
+		},
+		{
+			rewrite:  RewriteCluster,
+			src:      "CREATE TABLE db.t ON CLUSTER main (a UInt8) ENGINE = ReplicatedMergeTree('/tables/{shard}/t', '{replica}') ORDER BY a",
+			expected: "CREATE TABLE db.t (a UInt8) ENGINE = MergeTree() ORDER BY a",
+		},
+		{
+			rewrite:  RewriteReplicated,
+			src:      "CREATE TABLE t (a UInt8, v UInt64) Engine ReplicatedReplacingMergeTree('/tables/t', '{replica}', v) ORDER BY a",
+			expected: "CREATE TABLE t (a UInt8, v UInt64) Engine ReplacingMergeTree(v) ORDER BY a",
+		},
+		{
+			rewrite:  RewriteReplicated,
+			src:      "CREATE TABLE t (d Date, a UInt8) ENGINE = ReplicatedMergeTree('/tables/t', '{replica}', d, (d, a), 8192)",
+			expected: "CREATE TABLE t (d Date, a UInt8) ENGINE = MergeTree(d, (d, a), 8192)",
+		},
+		{
+			rewrite:  RewriteReplicated,
+			src:      "CREATE TABLE t (a UInt8) ENGINE = ReplicatedMergeTree ORDER BY a",
+			expected: "CREATE TABLE t (a UInt8) ENGINE = MergeTree ORDER BY a",
+		},
+		{
+			rewrite:  RewriteCluster,
+			src:      "CREATE TABLE db.t_all ON CLUSTER main AS db.t ENGINE = Distributed(main, db, t, rand())",
+			expected: "CREATE TABLE db.t_all AS db.t ENGINE = Merge(db, '^t$')",
+		},
+		{
+			rewrite:  RewriteDistributed,
+			src:      "CREATE TABLE t_all AS t ENGINE = Distributed('main', currentDatabase(), 't.local')",
+			expected: "CREATE TABLE t_all AS t ENGINE = Merge(currentDatabase(), '^t\\\\.local$')",
+		},
+		{
+			rewrite:  RewriteDistributed,
+			src:      "CREATE TABLE t_all AS t ENGINE = Distributed(main,, t)",
+			expected: "CREATE TABLE t_all AS t ENGINE = Distributed(main,, t)",
+		},
+		{
+			rewrite:  RewriteDistributed,
+			src:      "CREATE TABLE t_all AS t ENGINE = Distributed(main, db,)",
+			expected: "CREATE TABLE t_all AS t ENGINE = Distributed(main, db,)",
+		},
+		{
+			rewrite:  RewriteCluster | RewriteMemory,
+			src:      "CREATE TABLE t (a UInt8, b String TTL now() + INTERVAL 1 DAY, INDEX i b TYPE set(10) GRANULARITY 1) ENGINE = ReplicatedMergeTree('/t', 'r') PARTITION BY a ORDER BY (a, b) SETTINGS index_granularity = 1024",
+			expected: "CREATE TABLE t (a UInt8, b String) ENGINE = Memory",
+		},
+		{
+			rewrite:  RewriteMemory,
+			src:      "CREATE MATERIALIZED VIEW mv ENGINE = SummingMergeTree ORDER BY a POPULATE AS SELECT a, count() AS c FROM t GROUP BY a",
+			expected: "CREATE MATERIALIZED VIEW mv ENGINE = Memory POPULATE AS SELECT a, count() AS c FROM t GROUP BY a",
+		},
+		{
+			rewrite:  RewriteMemory,
+			src:      "CREATE TABLE t (INDEX i a TYPE minmax GRANULARITY 1, a UInt8) ENGINE MergeTree ORDER BY a",
+			expected: "CREATE TABLE t (a UInt8) ENGINE Memory",
+		},
+		{
+			rewrite:  RewriteCluster,
+			src:      "SELECT * FROM t JOIN s ON t.a = s.a",
+			expected: "SELECT * FROM t JOIN s ON t.a = s.a",
+		},
+		{
+			rewrite:  0,
+			src:      "CREATE TABLE t ON CLUSTER main (a UInt8) ENGINE = ReplicatedMergeTree('/t', 'r') ORDER BY a",
+			expected: "CREATE TABLE t ON CLUSTER main (a UInt8) ENGINE = ReplicatedMergeTree('/t', 'r') ORDER BY a",
+		},
+	}
+	for _, asset := range assets {
+		assert.Equal(t, asset.expected, rewriteQuery(asset.src, asset.rewrite))
+	}
+}
+
+func TestExecRewrite(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.SetRewrite(RewriteCluster | RewriteMemory)
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE rewrite_tester ON CLUSTER '{cluster}';
+	CREATE TABLE rewrite_tester.events ON CLUSTER '{cluster}' (
+		event_date Date
+		, user_id  UInt64
+	) Engine ReplicatedMergeTree('/clickhouse/tables/{shard}/events', '{replica}') ORDER BY user_id;
+	CREATE TABLE rewrite_tester.events_all ON CLUSTER '{cluster}' AS rewrite_tester.events
+	Engine Distributed('{cluster}', rewrite_tester, events, rand());
+	`
+	if err := clickhouse.Exec(ddl); assert.NoError(t, err) {
+		if schema, err := clickhouse.TableSchema("rewrite_tester", "events"); assert.NoError(t, err) {
+			assert.Equal(t, "Memory", schema.Engine)
+		}
+		if schema, err := clickhouse.TableSchema("rewrite_tester", "events_all"); assert.NoError(t, err) {
+			assert.Equal(t, "Merge", schema.Engine)
+		}
+		if err := clickhouse.Exec("INSERT INTO rewrite_tester.events SELECT toDate('2019-02-09'), 42"); assert.NoError(t, err) {
+			var count uint64
+			if err := clickhouse.DB().QueryRow("SELECT count() FROM rewrite_tester.events_all").Scan(&count); assert.NoError(t, err) {
+				assert.Equal(t, uint64(1), count)
+			}
+		}
+	}
+}
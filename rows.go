@@ -0,0 +1,177 @@
+package ok
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryRows runs the query and formats every value the way the TabSeparated format does,
+// so results can be compared with text fixtures.
+func (c *clickhouse) queryRows(query string, args ...interface{}) ([][]string, error) {
+	_, result, err := c.queryResult(query, args...)
+	return result, err
+}
+
+// queryResult runs the query like queryRows and also returns the types of the result columns.
+func (c *clickhouse) queryResult(query string, args ...interface{}) (types []string, result [][]string, _ error) {
+	rows, err := c.conn.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		values = make([]interface{}, len(columnTypes))
+		dest   = make([]interface{}, len(columnTypes))
+	)
+	for i, columnType := range columnTypes {
+		dest[i] = &values[i]
+		types = append(types, columnType.DatabaseTypeName())
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]string, 0, len(values))
+		for i, value := range values {
+			row = append(row, formatValue(types[i], value, false))
+		}
+		result = append(result, row)
+	}
+	return types, result, rows.Err()
+}
+
+// formatValue formats a value read by the driver as ClickHouse prints it in TabSeparated.
+// Strings and dates inside arrays are quoted.
+func formatValue(columnType string, value interface{}, quoted bool) string {
+	columnType = unwrapType(columnType)
+	switch v := value.(type) {
+	case nil:
+		if quoted {
+			return "NULL"
+		}
+		return `\N`
+	case string:
+		if quoted {
+			return quote(v)
+		}
+		return escapeTSV(v)
+	case []byte:
+		if strings.HasPrefix(columnType, "Array(") {
+			break
+		}
+		str := strings.TrimRight(string(v), "\x00")
+		if quoted {
+			return quote(str)
+		}
+		return escapeTSV(str)
+	case time.Time:
+		layout := "2006-01-02 15:04:05"
+		if strings.HasPrefix(columnType, "Date") && !strings.HasPrefix(columnType, "DateTime") {
+			layout = "2006-01-02"
+		}
+		if quoted {
+			return quote(v.Format(layout))
+		}
+		return v.Format(layout)
+	case float32:
+		return formatFloat(float64(v), 32)
+	case float64:
+		return formatFloat(v, 64)
+	case int32, int64:
+		if strings.HasPrefix(columnType, "Decimal") {
+			return formatDecimal(columnType, reflect.ValueOf(v).Int())
+		}
+	case fmt.Stringer:
+		if quoted {
+			return quote(v.String())
+		}
+		return v.String()
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return formatValue(columnType, nil, quoted)
+		}
+		return formatValue(columnType, v.Elem().Interface(), quoted)
+	case reflect.Slice:
+		var (
+			elementType = strings.TrimSuffix(strings.TrimPrefix(columnType, "Array("), ")")
+			elements    = make([]string, 0, v.Len())
+		)
+		for i := 0; i < v.Len(); i++ {
+			elements = append(elements, formatValue(elementType, v.Index(i).Interface(), true))
+		}
+		return "[" + strings.Join(elements, ",") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+// formatFloat formats the float the way ClickHouse does: the shortest representation, with
+// an exponent below 1e-6 and from 1e21 on, and inf, -inf and nan.
+func formatFloat(v float64, bitSize int) string {
+	switch {
+	case math.IsNaN(v):
+		return "nan"
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	}
+	value := strconv.FormatFloat(v, 'e', -1, bitSize)
+	i := strings.IndexByte(value, 'e')
+	if exponent, _ := strconv.Atoi(value[i+1:]); exponent < -6 || exponent >= 21 {
+		return value[:i+1] + strconv.Itoa(exponent)
+	}
+	return strconv.FormatFloat(v, 'f', -1, bitSize)
+}
+
+// formatDecimal formats the integral value of a Decimal(P, S) column with its scale.
+func formatDecimal(columnType string, value int64) string {
+	var scale int
+	if args := strings.Split(strings.TrimSuffix(columnType[strings.Index(columnType, "(")+1:], ")"), ","); len(args) != 0 {
+		scale, _ = strconv.Atoi(strings.TrimSpace(args[len(args)-1]))
+	}
+	return new(big.Rat).SetFrac(big.NewInt(value), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).FloatString(scale)
+}
+
+// inLocation returns the DateTime values, also of arrays, in the location, the values of other types as they are.
+// Their text form is then the one the server shows for the instants in its time zone.
+func inLocation(columnType string, value interface{}, location *time.Location) interface{} {
+	if !strings.Contains(columnType, "DateTime") {
+		return value
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v.In(location)
+	case []time.Time:
+		values := make([]time.Time, 0, len(v))
+		for _, value := range v {
+			values = append(values, value.In(location))
+		}
+		return values
+	}
+	return value
+}
+
+// unwrapType strips the Nullable and LowCardinality wrappers of a column type.
+func unwrapType(columnType string) string {
+	for _, wrapper := range []string{"Nullable(", "LowCardinality("} {
+		if strings.HasPrefix(columnType, wrapper) {
+			return unwrapType(strings.TrimSuffix(strings.TrimPrefix(columnType, wrapper), ")"))
+		}
+	}
+	return columnType
+}
+
+func escapeTSV(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`).Replace(value)
+}
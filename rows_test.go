@@ -0,0 +1,50 @@
+package ok
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatValue(t *testing.T) {
+	one := int32(1)
+	type asset struct {
+		columnType string
+		value      interface{}
+		expected   string
+	}
+	assets := []asset{
+		{"String", "a\tb\\c", `a\tb\\c`},
+		{"Nullable(String)", nil, `\N`},
+		{"FixedString(4)", []byte("ab\x00\x00"), "ab"},
+		{"UInt64", uint64(42), "42"},
+		{"Int8", int8(-1), "-1"},
+		{"Float64", 0.1, "0.1"},
+		{"Float32", float32(1.5), "1.5"},
+		{"Float64", 1e100, "1e100"},
+		{"Float64", 123456789012345.0, "123456789012345"},
+		{"Float64", -1.5e-7, "-1.5e-7"},
+		{"Float64", 0.000001, "0.000001"},
+		{"Float64", math.Inf(1), "inf"},
+		{"Float64", math.Inf(-1), "-inf"},
+		{"Float64", math.NaN(), "nan"},
+		{"Float32", float32(math.Inf(-1)), "-inf"},
+		{"Float32", float32(3e38), "3e38"},
+		{"Date", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), "2020-01-02"},
+		{"DateTime", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "2020-01-02 03:04:05"},
+		{"Decimal(9, 2)", int32(12345), "123.45"},
+		{"Nullable(Decimal64(3))", int64(-1500), "-1.500"},
+		{"Array(String)", []string{"a", "b'c"}, `['a','b\'c']`},
+		{"Array(UInt8)", []uint8{1, 2}, "[1,2]"},
+		{"Array(Nullable(Int32))", []interface{}{int32(1), nil}, "[1,NULL]"},
+		{"Array(Nullable(Int32))", []*int32{&one, nil}, "[1,NULL]"},
+		{"LowCardinality(String)", "a", "a"},
+		{"Array(Array(UInt32))", [][]uint32{{1}, {2, 3}}, "[[1],[2,3]]"},
+		{"Array(Date)", []time.Time{time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)}, "['2020-01-02']"},
+	}
+	for _, asset := range assets {
+		assert.Equal(t, asset.expected, formatValue(asset.columnType, asset.value, false), asset.columnType)
+	}
+}
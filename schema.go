@@ -0,0 +1,172 @@
+package ok
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// TableSchema is the shape of a table as reported by system.tables and system.columns.
+// Expressions are compared in the form the server normalizes them to, e.g. "CODEC(Delta(4), LZ4)".
+type TableSchema struct {
+	Engine       string
+	PartitionKey string
+	SortingKey   string
+	PrimaryKey   string
+	SamplingKey  string
+	TTL          string
+	Columns      []ColumnSchema
+}
+
+type ColumnSchema struct {
+	Name              string
+	Type              string
+	DefaultKind       string
+	DefaultExpression string
+	Codec             string
+}
+
+func (s *TableSchema) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "engine: %s\n", s.Engine)
+	fmt.Fprintf(&b, "partition key: %s\n", s.PartitionKey)
+	fmt.Fprintf(&b, "sorting key: %s\n", s.SortingKey)
+	fmt.Fprintf(&b, "primary key: %s\n", s.PrimaryKey)
+	fmt.Fprintf(&b, "sampling key: %s\n", s.SamplingKey)
+	fmt.Fprintf(&b, "ttl: %s\n", s.TTL)
+	for _, column := range s.Columns {
+		line := column.Name + " " + column.Type
+		if len(column.DefaultKind) != 0 {
+			line += " " + column.DefaultKind + " " + column.DefaultExpression
+		}
+		if len(column.Codec) != 0 {
+			line += " " + column.Codec
+		}
+		fmt.Fprintf(&b, "column %s\n", line)
+	}
+	return b.String()
+}
+
+func (c *clickhouse) TableSchema(database, table string) (*TableSchema, error) {
+	var (
+		schema     TableSchema
+		engineFull string
+	)
+	const query = `
+		SELECT
+			engine
+			, partition_key
+			, sorting_key
+			, primary_key
+			, sampling_key
+			, engine_full
+		FROM system.tables
+		WHERE database = ? AND name = ?
+	`
+	if err := c.conn.QueryRow(query, database, table).Scan(
+		&schema.Engine,
+		&schema.PartitionKey,
+		&schema.SortingKey,
+		&schema.PrimaryKey,
+		&schema.SamplingKey,
+		&engineFull,
+	); err != nil {
+		return nil, fmt.Errorf("could not read table '%s.%s': %v", database, table, err)
+	}
+	schema.TTL = extractTTL(engineFull)
+	rows, err := c.conn.Query(`
+		SELECT
+			name
+			, type
+			, default_kind
+			, default_expression
+			, compression_codec
+		FROM system.columns
+		WHERE database = ? AND table = ?
+	`, database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column ColumnSchema
+		if err := rows.Scan(&column.Name, &column.Type, &column.DefaultKind, &column.DefaultExpression, &column.Codec); err != nil {
+			return nil, err
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	return &schema, rows.Err()
+}
+
+func (c *clickhouse) AssertTableSchema(database, table string, expected *TableSchema) bool {
+	actual, err := c.TableSchema(database, table)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading the table schema: %v", err)
+		return false
+	}
+	return c.assertTableSchema(database, table, expected, actual)
+}
+
+// AssertTableSchemaDDL compares the table with the schema the server builds from the given CREATE TABLE
+// statement. The statement is rewritten like Exec does and executed in a scratch database which is dropped afterwards.
+func (c *clickhouse) AssertTableSchemaDDL(database, table, ddl string) bool {
+	expected, err := c.schemaFromDDL(ddl)
+	if err != nil {
+		c.test.Errorf("could not build the expected schema: %v", err)
+		return false
+	}
+	actual, err := c.TableSchema(database, table)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading the table schema: %v", err)
+		return false
+	}
+	return c.assertTableSchema(database, table, expected, actual)
+}
+
+func (c *clickhouse) assertTableSchema(database, table string, expected, actual *TableSchema) bool {
+	if e, a := expected.String(), actual.String(); e != a {
+		c.test.Errorf("table '%s.%s' does not match the expected schema:\n%s", database, table, diff(e, a))
+		return false
+	}
+	return true
+}
+
+func (c *clickhouse) schemaFromDDL(ddl string) (*TableSchema, error) {
+	table, err := ParseCreateTable(ddl)
+	if err != nil {
+		return nil, err
+	}
+	scratch := fmt.Sprintf("ok_schema_%d", time.Now().UnixNano())
+	if _, err := c.conn.Exec("CREATE DATABASE " + scratch); err != nil {
+		return nil, err
+	}
+	defer c.conn.Exec("DROP DATABASE IF EXISTS " + scratch)
+	table.Database, table.Name, table.Temporary = scratch, "expected", false
+	if _, err := c.conn.Exec(rewriteQuery(table.String(), c.rewrite)); err != nil {
+		return nil, err
+	}
+	return c.TableSchema(scratch, "expected")
+}
+
+var ttlClause = regexp.MustCompile(`\sTTL\s(.+?)(?:\sSETTINGS\s.*)?$`)
+
+func extractTTL(engineFull string) string {
+	if match := ttlClause.FindStringSubmatch(engineFull); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return ""
+}
+
+func diff(expected, actual string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expected),
+		B:        difflib.SplitLines(actual),
+		FromFile: "Expected",
+		ToFile:   "Actual",
+		Context:  1,
+	})
+	return diff
+}
@@ -0,0 +1,61 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractTTL(t *testing.T) {
+	assets := map[string]string{
+		"MergeTree ORDER BY id SETTINGS index_granularity = 8192":                                                   "",
+		"MergeTree PARTITION BY toYYYYMM(d) ORDER BY id TTL d + toIntervalDay(1) SETTINGS index_granularity = 8192": "d + toIntervalDay(1)",
+		"MergeTree ORDER BY id TTL d + toIntervalMonth(1)":                                                          "d + toIntervalMonth(1)",
+		"Memory": "",
+	}
+	for src, expected := range assets {
+		assert.Equal(t, expected, extractTTL(src))
+	}
+}
+
+func TestAssertTableSchema(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE schema_tester;
+	CREATE TABLE schema_tester.events (
+		event_date   Date
+		, event_type String DEFAULT 'view'
+		, user_id    UInt64
+	) Engine MergeTree PARTITION BY toYYYYMM(event_date) ORDER BY (event_date, user_id);
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, clickhouse.AssertTableSchema("schema_tester", "events", &TableSchema{
+		Engine:       "MergeTree",
+		PartitionKey: "toYYYYMM(event_date)",
+		SortingKey:   "event_date, user_id",
+		PrimaryKey:   "event_date, user_id",
+		Columns: []ColumnSchema{
+			{Name: "event_date", Type: "Date"},
+			{Name: "event_type", Type: "String", DefaultKind: "DEFAULT", DefaultExpression: "'view'"},
+			{Name: "user_id", Type: "UInt64"},
+		},
+	}))
+	assert.True(t, clickhouse.AssertTableSchemaDDL("schema_tester", "events", `
+	CREATE TABLE events (
+		event_date   Date
+		, event_type String DEFAULT 'view'
+		, user_id    UInt64
+	) Engine MergeTree PARTITION BY toYYYYMM(event_date) ORDER BY (event_date, user_id)
+	`))
+	clickhouse.SetRewrite(RewriteCluster)
+	assert.True(t, clickhouse.AssertTableSchemaDDL("schema_tester", "events", `
+	CREATE TABLE events ON CLUSTER '{cluster}' (
+		event_date   Date
+		, event_type String DEFAULT 'view'
+		, user_id    UInt64
+	) Engine ReplicatedMergeTree('/clickhouse/tables/{shard}/events', '{replica}') PARTITION BY toYYYYMM(event_date) ORDER BY (event_date, user_id)
+	`))
+}
@@ -0,0 +1,236 @@
+package ok
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Select runs the query and appends a struct per row to the slice dest points to.
+// Columns are mapped to fields with the same `ch:"column"` tags InsertStructs uses.
+func (c *clickhouse) Select(dest interface{}, query string, args ...interface{}) error {
+	slice, err := slicePointer(dest)
+	if err != nil {
+		return err
+	}
+	var (
+		elem = slice.Type().Elem()
+		ptr  = elem.Kind() == reflect.Ptr
+	)
+	if ptr {
+		elem = elem.Elem()
+	}
+	fields, err := structFields(elem)
+	if err != nil {
+		return err
+	}
+	var targets []func(reflect.Value, interface{}) error
+	return c.scanRows(query, args, func(columns, types []string, values []interface{}) error {
+		if targets == nil {
+			for i, column := range columns {
+				target, err := structTarget(elem, fields, column, types[i])
+				if err != nil {
+					return err
+				}
+				targets = append(targets, target)
+			}
+		}
+		item := reflect.New(elem).Elem()
+		for i, value := range values {
+			if err := targets[i](item, value); err != nil {
+				return err
+			}
+		}
+		if ptr {
+			item = item.Addr()
+		}
+		slice.Set(reflect.Append(slice, item))
+		return nil
+	})
+}
+
+// SelectMaps runs the query and returns a map of column names to the driver values per row.
+func (c *clickhouse) SelectMaps(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	err := c.scanRows(query, args, func(columns, _ []string, values []interface{}) error {
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result = append(result, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SelectColumn runs a single column query and appends the values to the slice dest points to.
+func (c *clickhouse) SelectColumn(dest interface{}, query string, args ...interface{}) error {
+	slice, err := slicePointer(dest)
+	if err != nil {
+		return err
+	}
+	return c.scanRows(query, args, func(columns, types []string, values []interface{}) error {
+		if len(columns) != 1 {
+			return fmt.Errorf("SelectColumn expects a single column, the query returns %d: %s", len(columns), strings.Join(columns, ", "))
+		}
+		item := reflect.New(slice.Type().Elem()).Elem()
+		if err := assignValue(item, values[0]); err != nil {
+			return scanError(columns[0], types[0], values[0], "", item.Type(), err)
+		}
+		slice.Set(reflect.Append(slice, item))
+		return nil
+	})
+}
+
+func (c *clickhouse) scanRows(query string, args []interface{}, fn func(columns, types []string, values []interface{}) error) error {
+	rows, err := c.conn.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	var (
+		columns = make([]string, 0, len(columnTypes))
+		types   = make([]string, 0, len(columnTypes))
+		dest    = make([]interface{}, len(columnTypes))
+	)
+	for i, columnType := range columnTypes {
+		columns = append(columns, columnType.Name())
+		types = append(types, columnType.DatabaseTypeName())
+		dest[i] = new(interface{})
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		values := make([]interface{}, 0, len(dest))
+		for _, value := range dest {
+			values = append(values, *value.(*interface{}))
+		}
+		if err := fn(columns, types, values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func slicePointer(dest interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf("expected a pointer to a slice, got %T", dest)
+	}
+	return value.Elem(), nil
+}
+
+// structTarget returns the function that stores the values of the column in the struct.
+// Columns of a Nested column, e.g. "items.id", fill the field of each element of the nested slice.
+func structTarget(t reflect.Type, fields []structField, column, columnType string) (func(reflect.Value, interface{}) error, error) {
+	for _, field := range fields {
+		field := field
+		if field.nested == nil && field.column == column {
+			fieldType := t.FieldByIndex(field.index)
+			return func(item reflect.Value, value interface{}) error {
+				if err := assignValue(item.FieldByIndex(field.index), value); err != nil {
+					return scanError(column, columnType, value, fieldType.Name, fieldType.Type, err)
+				}
+				return nil
+			}, nil
+		}
+		if field.nested == nil || !strings.HasPrefix(column, field.column+".") {
+			continue
+		}
+		for _, nested := range field.nested {
+			nested := nested
+			if field.column+"."+nested.column != column {
+				continue
+			}
+			var (
+				sliceType  = t.FieldByIndex(field.index).Type
+				nestedType = sliceType.Elem().FieldByIndex(nested.index)
+				name       = field.name + "." + nestedType.Name
+			)
+			return func(item reflect.Value, value interface{}) error {
+				values := reflect.ValueOf(value)
+				if values.Kind() != reflect.Slice {
+					return scanError(column, columnType, value, name, nestedType.Type, fmt.Errorf("not an array"))
+				}
+				slice := item.FieldByIndex(field.index)
+				if slice.Len() < values.Len() {
+					grown := reflect.MakeSlice(sliceType, values.Len(), values.Len())
+					reflect.Copy(grown, slice)
+					slice.Set(grown)
+				}
+				for i := 0; i < values.Len(); i++ {
+					if err := assignValue(slice.Index(i).FieldByIndex(nested.index), values.Index(i).Interface()); err != nil {
+						return scanError(column, columnType, value, name, nestedType.Type, err)
+					}
+				}
+				return nil
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("column '%s' has no field tagged `ch:\"%s\"` in %s", column, column, t)
+}
+
+// assignValue stores the driver value in the destination. Kinds have to match,
+// named types are converted, NULL needs a pointer or an interface destination.
+func assignValue(dest reflect.Value, value interface{}) error {
+	if value == nil {
+		switch dest.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		return fmt.Errorf("NULL needs a pointer")
+	}
+	v := reflect.ValueOf(value)
+	switch dest.Kind() {
+	case reflect.Interface:
+		if !v.Type().Implements(dest.Type()) {
+			return fmt.Errorf("%s does not implement %s", v.Type(), dest.Type())
+		}
+		dest.Set(v)
+		return nil
+	case reflect.Ptr:
+		elem := reflect.New(dest.Type().Elem())
+		if err := assignValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		dest.Set(elem)
+		return nil
+	case reflect.Slice:
+		if v.Kind() != reflect.Slice {
+			break
+		}
+		if v.Type().ConvertibleTo(dest.Type()) {
+			dest.Set(v.Convert(dest.Type()))
+			return nil
+		}
+		slice := reflect.MakeSlice(dest.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := assignValue(slice.Index(i), v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		dest.Set(slice)
+		return nil
+	}
+	if v.Kind() != dest.Kind() || !v.Type().ConvertibleTo(dest.Type()) {
+		return fmt.Errorf("incompatible types")
+	}
+	dest.Set(v.Convert(dest.Type()))
+	return nil
+}
+
+func scanError(column, columnType string, value interface{}, field string, fieldType reflect.Type, err error) error {
+	if len(field) != 0 {
+		field = " field '" + field + "' of"
+	}
+	return fmt.Errorf("cannot scan column '%s' (%s, driver type %T) into%s type %s: %v", column, columnType, value, field, fieldType, err)
+}
@@ -0,0 +1,148 @@
+package ok
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignValue(t *testing.T) {
+	var (
+		status   structsStatus
+		value    *float64
+		tags     []string
+		anything interface{}
+		small    int32
+	)
+	if assert.NoError(t, assignValue(reflect.ValueOf(&status).Elem(), "new")) {
+		assert.Equal(t, structsStatus("new"), status)
+	}
+	if assert.NoError(t, assignValue(reflect.ValueOf(&value).Elem(), 4.2)) {
+		assert.Equal(t, 4.2, *value)
+	}
+	if assert.NoError(t, assignValue(reflect.ValueOf(&value).Elem(), nil)) {
+		assert.Nil(t, value)
+	}
+	if assert.NoError(t, assignValue(reflect.ValueOf(&tags).Elem(), []string{"a", "b"})) {
+		assert.Equal(t, []string{"a", "b"}, tags)
+	}
+	if assert.NoError(t, assignValue(reflect.ValueOf(&anything).Elem(), uint64(1))) {
+		assert.Equal(t, uint64(1), anything)
+	}
+	assert.Error(t, assignValue(reflect.ValueOf(&small).Elem(), uint64(1)))
+	assert.Error(t, assignValue(reflect.ValueOf(&small).Elem(), nil))
+}
+
+func TestStructTarget(t *testing.T) {
+	var (
+		event  structsEvent
+		item   = reflect.ValueOf(&event).Elem()
+		fields []structField
+		err    error
+	)
+	if fields, err = structFields(item.Type()); !assert.NoError(t, err) {
+		return
+	}
+	assets := []struct {
+		column     string
+		columnType string
+		value      interface{}
+	}{
+		{"user_id", "UInt64", uint64(1)},
+		{"status", "Enum8('new' = 1)", "new"},
+		{"items.id", "Array(UInt64)", []uint64{1, 2}},
+		{"items.title", "Array(String)", []string{"one", "two"}},
+	}
+	for _, asset := range assets {
+		if target, err := structTarget(item.Type(), fields, asset.column, asset.columnType); assert.NoError(t, err) {
+			assert.NoError(t, target(item, asset.value))
+		}
+	}
+	assert.Equal(t, structsEvent{
+		structsBase: structsBase{UserID: 1},
+		Status:      "new",
+		Items:       []structsItem{{ID: 1, Title: "one"}, {ID: 2, Title: "two"}},
+	}, event)
+	_, err = structTarget(item.Type(), fields, "missing", "UInt8")
+	assert.EqualError(t, err, "column 'missing' has no field tagged `ch:\"missing\"` in ok.structsEvent")
+	if target, err := structTarget(item.Type(), fields, "user_id", "Int32"); assert.NoError(t, err) {
+		assert.EqualError(t, target(item, int32(1)),
+			"cannot scan column 'user_id' (Int32, driver type int32) into field 'UserID' of type uint64: incompatible types",
+		)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE select_tester;
+	CREATE TABLE select_tester.events (
+		user_id      UInt64
+		, event_time DateTime
+		, status     Enum8('new' = 1, 'done' = 2)
+		, value      Nullable(Float64)
+		, tags       Array(String)
+		, items      Nested(
+			id      UInt64
+			, title String
+		)
+	) Engine Memory;
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	var (
+		value     = 4.2
+		eventTime = time.Now().Truncate(time.Second)
+		events    = []structsEvent{
+			{
+				structsBase: structsBase{UserID: 1},
+				EventTime:   eventTime,
+				Status:      "new",
+				Value:       &value,
+				Tags:        []string{"a", "b"},
+				Items:       []structsItem{{ID: 1, Title: "one"}},
+			},
+			{
+				structsBase: structsBase{UserID: 2},
+				EventTime:   eventTime,
+				Status:      "done",
+				Tags:        []string{},
+				Items:       []structsItem{},
+			},
+		}
+	)
+	if !assert.True(t, clickhouse.InsertStructs("select_tester.events", events)) {
+		return
+	}
+	var selected []structsEvent
+	if err := clickhouse.Select(&selected, "SELECT * FROM select_tester.events ORDER BY user_id"); assert.NoError(t, err) {
+		if assert.Len(t, selected, 2) {
+			assert.Equal(t, uint64(1), selected[0].UserID)
+			assert.Equal(t, eventTime.Unix(), selected[0].EventTime.Unix())
+			assert.Equal(t, structsStatus("new"), selected[0].Status)
+			if assert.NotNil(t, selected[0].Value) {
+				assert.Equal(t, 4.2, *selected[0].Value)
+			}
+			assert.Equal(t, []structsItem{{ID: 1, Title: "one"}}, selected[0].Items)
+			assert.Nil(t, selected[1].Value)
+		}
+	}
+	if rows, err := clickhouse.SelectMaps("SELECT user_id, value FROM select_tester.events ORDER BY user_id"); assert.NoError(t, err) {
+		assert.Equal(t, []map[string]interface{}{
+			{"user_id": uint64(1), "value": 4.2},
+			{"user_id": uint64(2), "value": nil},
+		}, rows)
+	}
+	var ids []uint64
+	if err := clickhouse.SelectColumn(&ids, "SELECT user_id FROM select_tester.events ORDER BY user_id"); assert.NoError(t, err) {
+		assert.Equal(t, []uint64{1, 2}, ids)
+	}
+	var small []int32
+	if err := clickhouse.SelectColumn(&small, "SELECT user_id FROM select_tester.events"); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "column 'user_id' (UInt64, driver type uint64)")
+	}
+}
@@ -0,0 +1,264 @@
+package ok
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// connector opens driver connections and applies the connection settings to each of them,
+// so the settings survive the reconnects the driver makes after a server exception.
+type connector struct {
+	dsn      string
+	driver   driver.Driver
+	settings *connSettings
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, setting := range c.settings.tagging() {
+		if err := execSetting(conn, setting); err != nil {
+			conn.Close()
+			if code, _ := errorCode(err); code != UnknownSetting {
+				return nil, err
+			}
+			// log_comment is available since 20.5, older servers run the queries untagged
+			c.settings.untag()
+			return c.Connect(ctx)
+		}
+	}
+	for _, setting := range c.settings.get() {
+		if err := execSetting(conn, setting); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+func execSetting(conn driver.Conn, setting Setting) error {
+	stmt, err := conn.Prepare("SET " + setting.Name + " = " + setting.Value)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+type connSettings struct {
+	mutex    sync.Mutex
+	tag      string
+	untagged bool
+	settings []Setting
+}
+
+// tagging returns the settings that log the queries with the tag of the test as log_comment.
+func (s *connSettings) tagging() []Setting {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	settings := []Setting{{Name: "log_queries", Value: "1"}}
+	if !s.untagged {
+		settings = append(settings, Setting{Name: "log_comment", Value: quote(s.tag)})
+	}
+	return settings
+}
+
+func (s *connSettings) untag() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.untagged = true
+}
+
+func (s *connSettings) tagged() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.untagged
+}
+
+func (s *connSettings) get() []Setting {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Setting(nil), s.settings...)
+}
+
+func (s *connSettings) set(settings []Setting) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.settings = settings
+}
+
+// merge returns the settings with the updates applied. The updates are moved to the end so the
+// connector replays them after a settings profile selected before them, as they were applied.
+func merge(settings []Setting, updates []Setting) []Setting {
+	merged := make([]Setting, 0, len(settings)+len(updates))
+settings:
+	for _, setting := range settings {
+		for _, update := range updates {
+			if setting.Name == update.Name {
+				continue settings
+			}
+		}
+		merged = append(merged, setting)
+	}
+	return append(merged, updates...)
+}
+
+// WithSettings applies the settings to the connection for the rest of the test.
+func (c *clickhouse) WithSettings(settings map[string]interface{}) ClickHouse {
+	updates := toSettings(settings)
+	if err := c.applySettings(updates); err != nil {
+		c.test.Errorf("an error occurred while applying settings: %v", err)
+		return c
+	}
+	c.settings.set(merge(c.settings.get(), updates))
+	return c
+}
+
+// WithProfile selects the settings profile for the rest of the test. The settings of the profile
+// override the ones applied before, settings applied later override the profile.
+func (c *clickhouse) WithProfile(profile string) ClickHouse {
+	updates := []Setting{{Name: "profile", Value: quote(profile)}}
+	if err := c.applySettings(updates); err != nil {
+		c.test.Errorf("an error occurred while selecting the settings profile: %v", err)
+		return c
+	}
+	c.settings.set(merge(c.settings.get(), updates))
+	return c
+}
+
+// Settings applies the settings for the duration of fn and then restores the previous values.
+func (c *clickhouse) Settings(settings map[string]interface{}, fn func()) bool {
+	var (
+		updates  = toSettings(settings)
+		names    = make([]string, 0, len(updates))
+		previous = c.settings.get()
+	)
+	for _, setting := range updates {
+		names = append(names, setting.Name)
+	}
+	values, err := c.settingValues(names)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading settings: %v", err)
+		return false
+	}
+	restore := make([]Setting, 0, len(updates))
+	for _, name := range names {
+		value, found := values[name]
+		if !found {
+			c.test.Errorf("unknown setting '%s'", name)
+			return false
+		}
+		restore = append(restore, Setting{Name: name, Value: quote(value)})
+	}
+	if err := c.applySettings(updates); err != nil {
+		c.test.Errorf("an error occurred while applying settings: %v", err)
+		return false
+	}
+	c.settings.set(merge(previous, updates))
+	ok := true
+	defer func() {
+		c.settings.set(previous)
+		if err := c.applySettings(restore); err != nil {
+			c.test.Errorf("an error occurred while restoring settings: %v", err)
+			ok = false
+		}
+	}()
+	fn()
+	return ok
+}
+
+// AssertSettings checks the values the server reports in system.settings for the connection.
+func (c *clickhouse) AssertSettings(expected map[string]interface{}) bool {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values, err := c.settingValues(names)
+	if err != nil {
+		c.test.Errorf("an error occurred while reading settings: %v", err)
+		return false
+	}
+	ok := true
+	for _, name := range names {
+		value, found := values[name]
+		switch expected := settingValue(expected[name]); {
+		case !found:
+			c.test.Errorf("unknown setting '%s'", name)
+			ok = false
+		case value != expected:
+			c.test.Errorf("setting '%s': expected '%s', got '%s'", name, expected, value)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (c *clickhouse) applySettings(settings []Setting) error {
+	for _, setting := range settings {
+		if _, err := c.conn.Exec("SET " + setting.Name + " = " + setting.Value); err != nil {
+			return fmt.Errorf("SET %s = %s: %v", setting.Name, setting.Value, err)
+		}
+	}
+	return nil
+}
+
+func (c *clickhouse) settingValues(names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	if len(names) == 0 {
+		return values, nil
+	}
+	rows, err := c.conn.Query("SELECT name, value FROM system.settings WHERE name IN(?)", names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, rows.Err()
+}
+
+// toSettings converts the settings into SET statement literals ordered by name.
+func toSettings(settings map[string]interface{}) []Setting {
+	result := make([]Setting, 0, len(settings))
+	for name, value := range settings {
+		literal := settingValue(value)
+		if _, isString := value.(string); isString {
+			literal = quote(literal)
+		}
+		result = append(result, Setting{Name: name, Value: literal})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// settingValue formats the value the way system.settings shows it.
+func settingValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
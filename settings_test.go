@@ -0,0 +1,61 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSettings(t *testing.T) {
+	settings := toSettings(map[string]interface{}{
+		"max_memory_usage":   10000000000,
+		"join_use_nulls":     true,
+		"insert_deduplicate": false,
+		"log_comment":        "it's",
+	})
+	assert.Equal(t, []Setting{
+		{Name: "insert_deduplicate", Value: "0"},
+		{Name: "join_use_nulls", Value: "1"},
+		{Name: "log_comment", Value: `'it\'s'`},
+		{Name: "max_memory_usage", Value: "10000000000"},
+	}, settings)
+	assert.Equal(t, []Setting{
+		{Name: "a", Value: "1"},
+		{Name: "b", Value: "3"},
+		{Name: "c", Value: "4"},
+	}, merge([]Setting{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}, []Setting{{Name: "b", Value: "3"}, {Name: "c", Value: "4"}}))
+	assert.Equal(t, []Setting{
+		{Name: "profile", Value: "'default'"},
+		{Name: "a", Value: "2"},
+	}, merge([]Setting{{Name: "a", Value: "1"}, {Name: "profile", Value: "'default'"}}, []Setting{{Name: "a", Value: "2"}}))
+}
+
+func TestSettings(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.WithSettings(map[string]interface{}{
+		"max_block_size": 1024,
+	})
+	if assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"max_block_size": 1024})) {
+		// the driver reconnects after an exception, the settings have to survive it.
+		assert.Error(t, clickhouse.Exec("SELECT * FROM system.not_exists_table"))
+		assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"max_block_size": 1024}))
+	}
+	assert.True(t, clickhouse.Settings(map[string]interface{}{"join_use_nulls": true, "max_block_size": 2048}, func() {
+		assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"join_use_nulls": true, "max_block_size": 2048}))
+	}))
+	assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"join_use_nulls": false, "max_block_size": 1024}))
+}
+
+func TestWithProfile(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	// the default profile of the server image sets max_memory_usage to 10000000000
+	clickhouse.WithSettings(map[string]interface{}{"max_memory_usage": 20000000000, "max_block_size": 1024})
+	clickhouse.WithProfile("default")
+	if assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"max_memory_usage": 10000000000, "max_block_size": 1024})) {
+		// the profile is replayed after the settings applied before it
+		assert.Error(t, clickhouse.Exec("SELECT * FROM system.not_exists_table"))
+		assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"max_memory_usage": 10000000000, "max_block_size": 1024}))
+	}
+	clickhouse.WithSettings(map[string]interface{}{"max_memory_usage": 20000000000})
+	assert.True(t, clickhouse.AssertSettings(map[string]interface{}{"max_memory_usage": 20000000000}))
+}
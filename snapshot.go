@@ -0,0 +1,209 @@
+package ok
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	uuid       = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	uuidClause = regexp.MustCompile(`\sUUID\s+'[^']*'`)
+	// defaultSettings are the engine settings the server adds to SHOW CREATE TABLE with their default values.
+	defaultSettings = map[string]string{
+		"index_granularity": "8192",
+	}
+)
+
+// SchemaSnapshot returns the normalized SHOW CREATE output of every table, view and dictionary in the database.
+func (c *clickhouse) SchemaSnapshot(database string) (string, error) {
+	tables, err := c.ShowTables(database)
+	if err != nil {
+		return "", err
+	}
+	dictionaries, err := c.showDictionaries(database)
+	if err != nil {
+		return "", err
+	}
+	objects := make(map[string]string, len(tables)+len(dictionaries))
+	for _, table := range tables {
+		objects[table] = "TABLE"
+	}
+	for _, dictionary := range dictionaries {
+		objects[dictionary] = "DICTIONARY"
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var snapshot strings.Builder
+	for i, name := range names {
+		var ddl string
+		if err := c.conn.QueryRow("SHOW CREATE " + objects[name] + " " + database + "." + name).Scan(&ddl); err != nil {
+			return "", fmt.Errorf("could not show '%s.%s': %v", database, name, err)
+		}
+		if i != 0 {
+			snapshot.WriteString("\n")
+		}
+		fmt.Fprintf(&snapshot, "-- %s\n%s;\n", name, normalizeDDL(ddl))
+	}
+	return snapshot.String(), nil
+}
+
+// AssertSchemaSnapshot compares the schema of the database with the golden file.
+// Run tests with -ok.update to create or refresh the file.
+func (c *clickhouse) AssertSchemaSnapshot(database, golden string) bool {
+	snapshot, err := c.SchemaSnapshot(database)
+	if err != nil {
+		c.test.Errorf("an error occurred while taking the schema snapshot: %v", err)
+		return false
+	}
+	golden = c.goldenPath(golden)
+	if *update {
+		if err := writeGolden(golden, snapshot); err != nil {
+			c.test.Errorf("could not update golden file: %v", err)
+			return false
+		}
+		return true
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		c.test.Errorf("could not read golden file (run with -ok.update to create it): %v", err)
+		return false
+	}
+	if string(expected) != snapshot {
+		c.test.Errorf("schema of database '%s' differs from '%s':\n%s", database, golden, diff(string(expected), snapshot))
+		return false
+	}
+	return true
+}
+
+func (c *clickhouse) showDictionaries(database string) (dictionaries []string, _ error) {
+	rows, err := c.conn.Query("SELECT name FROM system.dictionaries WHERE database = ?", database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dictionary string
+		if err := rows.Scan(&dictionary); err != nil {
+			return nil, err
+		}
+		dictionaries = append(dictionaries, dictionary)
+	}
+	return dictionaries, rows.Err()
+}
+
+// normalizeDDL collapses whitespace and removes the parts of a statement that depend
+// on the server rather than on the schema: table UUIDs and default engine settings.
+func normalizeDDL(ddl string) string {
+	ddl = collapseSpaces(ddl)
+	ddl = uuidClause.ReplaceAllString(ddl, "")
+	ddl = uuid.ReplaceAllString(ddl, "<uuid>")
+	return strings.TrimSuffix(dropDefaultSettings(ddl), ";")
+}
+
+// dropDefaultSettings removes the default settings from the SETTINGS clause of the table engine.
+// SETTINGS in strings, comments, expressions and the SELECT of materialized views are kept.
+func dropDefaultSettings(ddl string) string {
+	tokens, err := lex(ddl)
+	if err != nil {
+		return ddl
+	}
+	var (
+		depth  int
+		engine bool
+	)
+	for i, tok := range tokens {
+		switch {
+		case tok.is("(") || tok.is("["):
+			depth++
+		case tok.is(")") || tok.is("]"):
+			depth--
+		case depth != 0:
+		case tok.isKeyword("ENGINE"):
+			engine = true
+		case engine && tok.isKeyword("AS"):
+			return ddl
+		case engine && tok.isKeyword("SETTINGS"):
+			p := parser{src: ddl, tokens: tokens, pos: i + 1}
+			settings, err := p.settings()
+			if err != nil {
+				return ddl
+			}
+			var kept []string
+			for _, setting := range settings {
+				if value, found := defaultSettings[setting.Name]; !found || value != setting.Value {
+					kept = append(kept, setting.Name+" = "+setting.Value)
+				}
+			}
+			clause := ""
+			if len(kept) != 0 {
+				clause = " SETTINGS " + strings.Join(kept, ", ")
+			}
+			return strings.TrimRight(ddl[:tok.pos], " ") + clause + ddl[tokens[p.pos-1].end:]
+		}
+	}
+	return ddl
+}
+
+// collapseSpaces collapses the whitespace outside of quotes into single spaces,
+// none after opening and before closing parentheses.
+func collapseSpaces(ddl string) string {
+	var (
+		out     strings.Builder
+		quote   byte
+		pending bool
+	)
+	for i := 0; i < len(ddl); i++ {
+		ch := ddl[i]
+		switch {
+		case quote != 0:
+			out.WriteByte(ch)
+			if ch == '\\' && i+1 < len(ddl) {
+				i++
+				out.WriteByte(ddl[i])
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			pending = true
+			continue
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		}
+		if pending && out.Len() != 0 && !strings.HasSuffix(out.String(), "(") && ch != ')' {
+			out.WriteByte(' ')
+		}
+		pending = false
+		out.WriteByte(ch)
+	}
+	return out.String()
+}
+
+// goldenPath returns the path of the golden file in the search path, so that updates overwrite
+// the file the comparison reads. New files go to the first directory of the search path.
+func (c *clickhouse) goldenPath(path string) string {
+	for _, searchPath := range c.searchPath {
+		if _, err := os.Stat(filepath.Join(searchPath, path)); err == nil {
+			return filepath.Join(searchPath, path)
+		}
+	}
+	if len(c.searchPath) != 0 {
+		return filepath.Join(c.searchPath[0], path)
+	}
+	return path
+}
+
+func writeGolden(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
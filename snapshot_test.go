@@ -0,0 +1,66 @@
+package ok
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDDL(t *testing.T) {
+	assets := map[string]string{
+		"CREATE TABLE db.t\n(\n    `a` UInt64\n)\nENGINE = MergeTree\nORDER BY a\nSETTINGS index_granularity = 8192":                                   "CREATE TABLE db.t (`a` UInt64) ENGINE = MergeTree ORDER BY a",
+		"CREATE TABLE db.t (a UInt64) ENGINE = MergeTree ORDER BY a SETTINGS index_granularity = 8192, min_bytes_for_wide_part = 0":                    "CREATE TABLE db.t (a UInt64) ENGINE = MergeTree ORDER BY a SETTINGS min_bytes_for_wide_part = 0",
+		"CREATE TABLE db.t UUID '3e1ab2c4-5b6d-4e7f-8a9b-0c1d2e3f4a5b' (a UInt64) ENGINE = Memory":                                                     "CREATE TABLE db.t (a UInt64) ENGINE = Memory",
+		"CREATE TABLE db.t (a UInt64) ENGINE = ReplicatedMergeTree('/tables/3e1ab2c4-5b6d-4e7f-8a9b-0c1d2e3f4a5b', 'r') ORDER BY a":                    "CREATE TABLE db.t (a UInt64) ENGINE = ReplicatedMergeTree('/tables/<uuid>', 'r') ORDER BY a",
+		"CREATE TABLE db.t\n(\n    `a` String DEFAULT '( a  b )' COMMENT 'it\\'s  ( )'\n)\nENGINE = Memory":                                            "CREATE TABLE db.t (`a` String DEFAULT '( a  b )' COMMENT 'it\\'s  ( )') ENGINE = Memory",
+		"CREATE TABLE db.t (a String DEFAULT 'SETTINGS x') ENGINE = Memory":                                                                            "CREATE TABLE db.t (a String DEFAULT 'SETTINGS x') ENGINE = Memory",
+		"CREATE TABLE db.t (a UInt64) ENGINE = MergeTree ORDER BY a SETTINGS index_granularity = 1024":                                                 "CREATE TABLE db.t (a UInt64) ENGINE = MergeTree ORDER BY a SETTINGS index_granularity = 1024",
+		"CREATE TABLE db.t (a UInt64) ENGINE = MergeTree ORDER BY a SETTINGS index_granularity = 8192 COMMENT 'a, SETTINGS b = 1'":                     "CREATE TABLE db.t (a UInt64) ENGINE = MergeTree ORDER BY a COMMENT 'a, SETTINGS b = 1'",
+		"CREATE MATERIALIZED VIEW db.v ENGINE = MergeTree ORDER BY a SETTINGS index_granularity = 8192 AS SELECT a FROM db.t SETTINGS max_threads = 1": "CREATE MATERIALIZED VIEW db.v ENGINE = MergeTree ORDER BY a AS SELECT a FROM db.t SETTINGS max_threads = 1",
+		"CREATE VIEW db.v AS SELECT a FROM db.t SETTINGS index_granularity = 8192":                                                                     "CREATE VIEW db.v AS SELECT a FROM db.t SETTINGS index_granularity = 8192",
+	}
+	for src, expected := range assets {
+		assert.Equal(t, expected, normalizeDDL(src))
+	}
+}
+
+func TestGoldenPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ok")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	c := clickhouse{searchPath: []string{dir, "."}}
+	assert.Equal(t, filepath.Join(dir, "schema.sql"), c.goldenPath("schema.sql"))
+	assert.Equal(t, "snapshot.go", c.goldenPath("snapshot.go"))
+	if assert.NoError(t, writeGolden(c.goldenPath("golden/schema.sql"), "")) {
+		assert.Equal(t, filepath.Join(dir, "golden/schema.sql"), c.goldenPath("golden/schema.sql"))
+	}
+}
+
+func TestSchemaSnapshot(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE snapshot_tester;
+	CREATE TABLE snapshot_tester.events (
+		event_date Date
+		, user_id  UInt64
+	) Engine MergeTree PARTITION BY toYYYYMM(event_date) ORDER BY user_id;
+	CREATE TABLE snapshot_tester.users (
+		user_id UInt64
+		, name  String
+	) Engine Memory;
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	if snapshot, err := clickhouse.SchemaSnapshot("snapshot_tester"); assert.NoError(t, err) {
+		assert.Contains(t, snapshot, "-- events\n")
+		assert.Contains(t, snapshot, "-- users\n")
+		assert.NotContains(t, snapshot, "index_granularity = 8192")
+	}
+}
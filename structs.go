@@ -0,0 +1,289 @@
+package ok
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structField maps a struct field tagged with `ch:"column"` to a column.
+// Fields holding a slice of structs map to the columns of a Nested column,
+// e.g. a field tagged `ch:"items"` of []Item with an Item field tagged `ch:"id"` maps to "items.id".
+type structField struct {
+	name   string
+	column string
+	index  []int
+	nested []structField
+}
+
+// structFields returns the column mapping of the struct type. Embedded structs are flattened,
+// untagged fields and fields tagged with "-" are skipped. Embedded pointers to structs are
+// reported, their fields cannot be read from nil pointers.
+func structFields(t reflect.Type) ([]structField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, got %s", t)
+	}
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		column, tagged := field.Tag.Lookup("ch")
+		switch {
+		case field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct:
+			embedded, err := structFields(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range embedded {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		case field.Anonymous && !tagged && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct:
+			return nil, fmt.Errorf("embedded field '%s' is a pointer, embed %s or tag the field with \"-\"", field.Name, field.Type.Elem())
+		case !tagged || column == "-":
+			continue
+		case len(field.PkgPath) != 0:
+			return nil, fmt.Errorf("field '%s' is tagged but not exported", field.Name)
+		}
+		f := structField{
+			name:   field.Name,
+			column: column,
+			index:  []int{i},
+		}
+		if isNested(field.Type) {
+			nested, err := structFields(field.Type.Elem())
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range nested {
+				if len(n.nested) != 0 {
+					return nil, fmt.Errorf("field '%s.%s': Nested columns cannot be nested", field.Name, n.name)
+				}
+			}
+			f.nested = nested
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct && t.Elem() != timeType
+}
+
+// structColumns returns the columns of the mapping with Nested columns flattened.
+func structColumns(fields []structField) []string {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.nested == nil {
+			columns = append(columns, field.column)
+			continue
+		}
+		for _, nested := range field.nested {
+			columns = append(columns, field.column+"."+nested.column)
+		}
+	}
+	return columns
+}
+
+// InsertStructs inserts the elements of the slice of structs into the table,
+// "database.table" or a table of the connection database.
+func (c *clickhouse) InsertStructs(table string, slice interface{}) bool {
+	value := reflect.ValueOf(slice)
+	if value.Kind() != reflect.Slice {
+		c.test.Errorf("InsertStructs expects a slice of structs, got %T", slice)
+		return false
+	}
+	elem := value.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	fields, err := structFields(elem)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	var (
+		database, name = c.splitName(table)
+		columns        = structColumns(fields)
+	)
+	if len(columns) == 0 {
+		c.test.Errorf("struct %s has no fields tagged with `ch:\"column\"`", elem)
+		return false
+	}
+	columnTypes, err := c.columnTypes(database, name, columns)
+	if err != nil {
+		c.test.Error(err)
+		return false
+	}
+	if err := checkStructTypes(elem, fields, columnTypes); err != nil {
+		c.test.Error(err)
+		return false
+	}
+	rows := make([][]interface{}, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		item := value.Index(i)
+		if item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				c.test.Errorf("InsertStructs: element %d is nil", i)
+				return false
+			}
+			item = item.Elem()
+		}
+		rows = append(rows, structRow(item, fields, columnTypes))
+	}
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, quoteIdentifier(column))
+	}
+	if err := c.insert("INSERT INTO "+database+"."+name+" ("+strings.Join(quoted, ", ")+") VALUES", rows); err != nil {
+		c.test.Error(err)
+		return false
+	}
+	return true
+}
+
+// checkStructTypes checks that the fields can be written to the columns of the types.
+func checkStructTypes(t reflect.Type, fields []structField, columnTypes []string) error {
+	var i int
+	for _, field := range fields {
+		fieldType := t.FieldByIndex(field.index).Type
+		if field.nested == nil {
+			if !compatibleType(fieldType, columnTypes[i]) {
+				return fmt.Errorf("field '%s' of type %s cannot be written to column '%s' of type %s", field.name, fieldType, field.column, columnTypes[i])
+			}
+			i++
+			continue
+		}
+		for _, nested := range field.nested {
+			nestedType := fieldType.Elem().FieldByIndex(nested.index).Type
+			if !compatibleType(reflect.SliceOf(nestedType), columnTypes[i]) {
+				return fmt.Errorf("field '%s.%s' of type %s cannot be written to column '%s.%s' of type %s",
+					field.name, nested.name, nestedType, field.column, nested.column, columnTypes[i],
+				)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+func structRow(item reflect.Value, fields []structField, columnTypes []string) []interface{} {
+	row := make([]interface{}, 0, len(columnTypes))
+	for _, field := range fields {
+		value := item.FieldByIndex(field.index)
+		if field.nested == nil {
+			row = append(row, toColumnValue(value, columnTypes[len(row)]))
+			continue
+		}
+		for _, nested := range field.nested {
+			column := reflect.MakeSlice(reflect.SliceOf(value.Type().Elem().FieldByIndex(nested.index).Type), 0, value.Len())
+			for j := 0; j < value.Len(); j++ {
+				column = reflect.Append(column, value.Index(j).FieldByIndex(nested.index))
+			}
+			row = append(row, toColumnValue(column, columnTypes[len(row)]))
+		}
+	}
+	return row
+}
+
+// columnGoType returns the Go type the driver writes to and reads from the column type.
+// Nullable columns map to pointers, LowCardinality columns to the type they wrap.
+func columnGoType(columnType string) (reflect.Type, bool) {
+	switch {
+	case strings.HasPrefix(columnType, "LowCardinality("):
+		return columnGoType(columnType[len("LowCardinality(") : len(columnType)-1])
+	case strings.HasPrefix(columnType, "Nullable("):
+		t, ok := columnGoType(columnType[len("Nullable(") : len(columnType)-1])
+		if !ok || t.Kind() == reflect.Ptr {
+			return nil, false
+		}
+		return reflect.PtrTo(t), true
+	case strings.HasPrefix(columnType, "Array("):
+		t, ok := columnGoType(columnType[len("Array(") : len(columnType)-1])
+		if !ok {
+			return nil, false
+		}
+		return reflect.SliceOf(t), true
+	case strings.HasPrefix(columnType, "Enum"), strings.HasPrefix(columnType, "FixedString("):
+		return reflect.TypeOf(""), true
+	case strings.HasPrefix(columnType, "Decimal"):
+		return reflect.TypeOf(float64(0)), true
+	case strings.HasPrefix(columnType, "DateTime("):
+		return timeType, true
+	}
+	t, ok := columnGoTypes[columnType]
+	return t, ok
+}
+
+var columnGoTypes = map[string]reflect.Type{
+	"Int8":     reflect.TypeOf(int8(0)),
+	"Int16":    reflect.TypeOf(int16(0)),
+	"Int32":    reflect.TypeOf(int32(0)),
+	"Int64":    reflect.TypeOf(int64(0)),
+	"UInt8":    reflect.TypeOf(uint8(0)),
+	"UInt16":   reflect.TypeOf(uint16(0)),
+	"UInt32":   reflect.TypeOf(uint32(0)),
+	"UInt64":   reflect.TypeOf(uint64(0)),
+	"Float32":  reflect.TypeOf(float32(0)),
+	"Float64":  reflect.TypeOf(float64(0)),
+	"String":   reflect.TypeOf(""),
+	"UUID":     reflect.TypeOf(""),
+	"Date":     timeType,
+	"DateTime": timeType,
+}
+
+// compatibleType reports whether values of the Go type can be converted to the column type.
+// Named types are accepted when their underlying kind matches.
+func compatibleType(t reflect.Type, columnType string) bool {
+	expected, ok := columnGoType(columnType)
+	if !ok {
+		return false
+	}
+	return compatible(t, expected)
+}
+
+func compatible(t, expected reflect.Type) bool {
+	switch expected.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return t.Kind() == expected.Kind() && compatible(t.Elem(), expected.Elem())
+	case reflect.Struct:
+		return t.ConvertibleTo(expected) && t.Kind() == reflect.Struct
+	}
+	return t.Kind() == expected.Kind()
+}
+
+// toColumnValue converts the value to the Go type the driver expects for the column type.
+func toColumnValue(value reflect.Value, columnType string) interface{} {
+	expected, _ := columnGoType(columnType)
+	converted := convertValue(value, expected)
+	if converted.Kind() == reflect.Ptr {
+		if converted.IsNil() {
+			return nil
+		}
+		converted = converted.Elem()
+	}
+	return converted.Interface()
+}
+
+func convertValue(value reflect.Value, expected reflect.Type) reflect.Value {
+	switch expected.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return reflect.Zero(expected)
+		}
+		ptr := reflect.New(expected.Elem())
+		ptr.Elem().Set(convertValue(value.Elem(), expected.Elem()))
+		return ptr
+	case reflect.Slice:
+		slice := reflect.MakeSlice(expected, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			slice = reflect.Append(slice, convertValue(value.Index(i), expected.Elem()))
+		}
+		return slice
+	}
+	return value.Convert(expected)
+}
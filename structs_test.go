@@ -0,0 +1,169 @@
+package ok
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	structsStatus string
+	structsItem   struct {
+		ID    uint64 `ch:"id"`
+		Title string `ch:"title"`
+	}
+	structsBase struct {
+		UserID uint64 `ch:"user_id"`
+	}
+	structsEvent struct {
+		structsBase
+		EventTime time.Time     `ch:"event_time"`
+		Status    structsStatus `ch:"status"`
+		Value     *float64      `ch:"value"`
+		Tags      []string      `ch:"tags"`
+		Items     []structsItem `ch:"items"`
+		Ignored   string        `ch:"-"`
+		Untagged  string
+	}
+)
+
+func TestStructFields(t *testing.T) {
+	fields, err := structFields(reflect.TypeOf(structsEvent{}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"user_id",
+			"event_time",
+			"status",
+			"value",
+			"tags",
+			"items.id",
+			"items.title",
+		}, structColumns(fields))
+	}
+	type unexported struct {
+		value string `ch:"value"`
+	}
+	_, err = structFields(reflect.TypeOf(unexported{}))
+	assert.Error(t, err)
+	type embeddedPointer struct {
+		*structsBase
+		Status string `ch:"status"`
+	}
+	if _, err := structFields(reflect.TypeOf(embeddedPointer{})); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "embedded field 'structsBase' is a pointer")
+	}
+}
+
+func TestCheckStructTypes(t *testing.T) {
+	fields, err := structFields(reflect.TypeOf(structsEvent{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	types := []string{
+		"UInt64",
+		"DateTime",
+		"Enum8('new' = 1, 'done' = 2)",
+		"Nullable(Float64)",
+		"Array(String)",
+		"Array(UInt64)",
+		"Array(String)",
+	}
+	assert.NoError(t, checkStructTypes(reflect.TypeOf(structsEvent{}), fields, types))
+	for i, columnType := range []string{"UInt32", "String", "UInt8", "Float64", "Array(UInt8)", "Array(Int64)", "String"} {
+		invalid := append([]string(nil), types...)
+		invalid[i] = columnType
+		assert.Error(t, checkStructTypes(reflect.TypeOf(structsEvent{}), fields, invalid), columnType)
+	}
+}
+
+func TestStructRow(t *testing.T) {
+	var (
+		value     = 4.2
+		eventTime = time.Date(2019, 2, 9, 10, 10, 10, 0, time.UTC)
+		event     = structsEvent{
+			structsBase: structsBase{UserID: 1},
+			EventTime:   eventTime,
+			Status:      "new",
+			Value:       &value,
+			Tags:        []string{"a", "b"},
+			Items:       []structsItem{{ID: 1, Title: "one"}, {ID: 2, Title: "two"}},
+		}
+		types = []string{"UInt64", "DateTime", "Enum8('new' = 1)", "Nullable(Float64)", "Array(String)", "Array(UInt64)", "Array(String)"}
+	)
+	fields, err := structFields(reflect.TypeOf(event))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []interface{}{
+		uint64(1),
+		eventTime,
+		"new",
+		4.2,
+		[]string{"a", "b"},
+		[]uint64{1, 2},
+		[]string{"one", "two"},
+	}, structRow(reflect.ValueOf(event), fields, types))
+	event.Value = nil
+	assert.Nil(t, structRow(reflect.ValueOf(event), fields, types)[3])
+}
+
+func TestInsertStructs(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE structs_tester;
+	CREATE TABLE structs_tester.events (
+		user_id      UInt64
+		, event_time DateTime
+		, status     Enum8('new' = 1, 'done' = 2)
+		, value      Nullable(Float64)
+		, tags       Array(String)
+		, items      Nested(
+			id      UInt64
+			, title String
+		)
+	) Engine Memory;
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	value := 4.2
+	events := []structsEvent{
+		{
+			structsBase: structsBase{UserID: 1},
+			EventTime:   time.Now().Truncate(time.Second),
+			Status:      "new",
+			Value:       &value,
+			Tags:        []string{"a", "b"},
+			Items:       []structsItem{{ID: 1, Title: "one"}, {ID: 2, Title: "two"}},
+		},
+		{
+			structsBase: structsBase{UserID: 2},
+			EventTime:   time.Now().Truncate(time.Second),
+			Status:      "done",
+		},
+	}
+	if assert.True(t, clickhouse.InsertStructs("structs_tester.events", events)) {
+		assert.True(t, clickhouse.Eventually("SELECT COUNT() FROM structs_tester.events WHERE value IS NULL", uint64(1), time.Second))
+		assert.True(t, clickhouse.Eventually("SELECT arrayStringConcat(items.title, ',') FROM structs_tester.events WHERE user_id = 1", "one,two", time.Second))
+	}
+}
+
+func TestStructRowWrappedTypes(t *testing.T) {
+	type scores struct {
+		Name   structsStatus `ch:"name"`
+		Scores []*int32      `ch:"scores"`
+	}
+	var (
+		one   = int32(1)
+		types = []string{"LowCardinality(String)", "Array(Nullable(Int32))"}
+		row   = scores{Name: "a", Scores: []*int32{&one, nil}}
+	)
+	fields, err := structFields(reflect.TypeOf(row))
+	if assert.NoError(t, err) && assert.NoError(t, checkStructTypes(reflect.TypeOf(row), fields, types)) {
+		assert.Equal(t, []interface{}{"a", []*int32{&one, nil}}, structRow(reflect.ValueOf(row), fields, types))
+	}
+	assert.Error(t, checkStructTypes(reflect.TypeOf(row), fields, []string{"LowCardinality(String)", "Array(Int32)"}))
+}
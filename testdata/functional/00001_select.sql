@@ -0,0 +1,5 @@
+-- constants and arrays
+SELECT 1, 'a\tb', [1, 2, 3];
+SELECT number, toString(number) FROM system.numbers LIMIT 3;
+SELECT NULL, toNullable(1);
+SELECT inf, -inf, nan, 1e100, 1e-7, 0.5;
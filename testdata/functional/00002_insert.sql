@@ -0,0 +1,15 @@
+CREATE DATABASE functional_tester;
+CREATE TABLE functional_tester.events (
+    event_date Date
+    , value    UInt64
+) Engine Memory;
+CREATE TABLE functional_tester.notes (
+    note String
+) Engine Memory;
+INSERT INTO functional_tester.events VALUES ('2019-02-09', 1), ('2019-02-10', 2);
+INSERT INTO functional_tester.events SELECT toDate('2019-02-11'), 3;
+SET max_threads = 1;
+SELECT * FROM functional_tester.events ORDER BY event_date;
+SELECT sum(value) FROM functional_tester.events;
+INSERT INTO functional_tester.notes (note) VALUES ('SELECT 1');
+SELECT note FROM functional_tester.notes;
@@ -0,0 +1 @@
+DROP DATABASE IF EXISTS migrations_tester;
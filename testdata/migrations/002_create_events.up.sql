@@ -0,0 +1,5 @@
+CREATE TABLE migrations_tester.events (
+	event_time   DateTime
+	, event_type String
+	, user_id    UInt64
+) Engine MergeTree ORDER BY event_time;
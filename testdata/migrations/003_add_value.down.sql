@@ -0,0 +1 @@
+ALTER TABLE migrations_tester.events DROP COLUMN value;
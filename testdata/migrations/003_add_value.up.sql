@@ -0,0 +1 @@
+ALTER TABLE migrations_tester.events ADD COLUMN value UInt32;
@@ -0,0 +1,211 @@
+package ok
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses versions like "19.14.3.3", "20.3" or "21.8.10.19-lts".
+// The build number, the fourth part, and suffixes are accepted but not kept.
+func ParseVersion(str string) (*Version, error) {
+	parts, err := versionParts(str)
+	if err != nil {
+		return nil, err
+	}
+	var version Version
+	for i, part := range parts {
+		if i < 3 {
+			*version.part(i) = part
+		}
+	}
+	return &version, nil
+}
+
+// versionParts returns the numbers of the version, up to four of them, without the suffix.
+func versionParts(str string) ([]int, error) {
+	src := strings.TrimPrefix(strings.TrimSpace(str), "v")
+	if i := strings.IndexAny(src, "- "); i != -1 {
+		src = src[:i]
+	}
+	fields := strings.Split(src, ".")
+	if len(fields) > 4 {
+		return nil, fmt.Errorf("invalid version '%s'", str)
+	}
+	parts := make([]int, 0, len(fields))
+	for _, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid version '%s'", str)
+		}
+		parts = append(parts, value)
+	}
+	return parts, nil
+}
+
+func (v *Version) Less(v2 *Version) bool {
+	return v.compare(v2, 3) < 0
+}
+
+func (v *Version) Equal(v2 *Version) bool {
+	return v.compare(v2, 3) == 0
+}
+
+func (v *Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// compare compares the first n parts of the versions.
+func (v *Version) compare(v2 *Version, n int) int {
+	for i := 0; i < n; i++ {
+		switch a, b := *v.part(i), *v2.part(i); {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v *Version) part(i int) *int {
+	switch i {
+	case 0:
+		return &v.Major
+	case 1:
+		return &v.Minor
+	}
+	return &v.Patch
+}
+
+// VersionConstraint is a requirement such as ">=19.3, <20" or "~19.14".
+// Comma separated conditions must all hold, alternatives are separated by "||".
+// A condition compares only the parts it specifies, so "<=19.3" matches 19.3.5
+// and "=19.14" matches any 19.14 release. "~19.14" matches 19.14 and later
+// 19.14 releases, "~19.14.3" matches 19.14.3 and later 19.14 releases.
+type VersionConstraint struct {
+	source       string
+	alternatives [][]condition
+}
+
+type condition struct {
+	operator string
+	version  Version
+	parts    int
+}
+
+func ParseVersionConstraint(str string) (*VersionConstraint, error) {
+	constraint := VersionConstraint{source: str}
+	for _, alternative := range strings.Split(str, "||") {
+		var conditions []condition
+		for _, src := range strings.Split(alternative, ",") {
+			if src = strings.TrimSpace(src); len(src) == 0 {
+				return nil, fmt.Errorf("invalid version constraint '%s': empty condition", str)
+			}
+			var cond condition
+			for _, operator := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~"} {
+				if strings.HasPrefix(src, operator) {
+					cond.operator, src = operator, strings.TrimSpace(src[len(operator):])
+					break
+				}
+			}
+			switch cond.operator {
+			case "", "==":
+				cond.operator = "="
+			}
+			parts, err := versionParts(src)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint '%s': %v", str, err)
+			}
+			if len(parts) > 3 {
+				return nil, fmt.Errorf("invalid version constraint '%s': build numbers are not compared", str)
+			}
+			for i, part := range parts {
+				*cond.version.part(i) = part
+			}
+			cond.parts = len(parts)
+			conditions = append(conditions, cond)
+		}
+		constraint.alternatives = append(constraint.alternatives, conditions)
+	}
+	return &constraint, nil
+}
+
+func (c *VersionConstraint) Check(v *Version) bool {
+alternatives:
+	for _, conditions := range c.alternatives {
+		for _, cond := range conditions {
+			if !cond.check(v) {
+				continue alternatives
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (c *VersionConstraint) String() string {
+	return c.source
+}
+
+func (cond *condition) check(v *Version) bool {
+	cmp := v.compare(&cond.version, cond.parts)
+	switch cond.operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "~":
+		keep := cond.parts
+		if keep > 2 {
+			keep = 2
+		}
+		return cmp >= 0 && v.compare(&cond.version, keep) == 0
+	}
+	return false
+}
+
+func (c *clickhouse) Version() (*Version, error) {
+	if c.version != nil {
+		return c.version, nil
+	}
+	var str string
+	if err := c.conn.QueryRow("SELECT version()").Scan(&str); err != nil {
+		return nil, err
+	}
+	version, err := ParseVersion(str)
+	if err != nil {
+		return nil, err
+	}
+	c.version = version
+	return version, nil
+}
+
+// RequireVersion skips the test when the server version does not satisfy the constraint.
+func (c *clickhouse) RequireVersion(constraint string) {
+	required, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		c.test.Fatal(err)
+	}
+	version, err := c.Version()
+	if err != nil {
+		c.test.Fatalf("could not get the server version: %v", err)
+	}
+	if !required.Check(version) {
+		c.test.Skipf("ClickHouse %s does not satisfy the version constraint '%s'", version, constraint)
+	}
+}
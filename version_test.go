@@ -0,0 +1,86 @@
+package ok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	assets := map[string]Version{
+		"19.14.3.3":        {19, 14, 3},
+		"21.8.10.19-lts":   {21, 8, 10},
+		"20.3":             {20, 3, 0},
+		"v1.1.54343":       {1, 1, 54343},
+		"22.1.1.1 testing": {22, 1, 1},
+	}
+	for src, expected := range assets {
+		if version, err := ParseVersion(src); assert.NoError(t, err) {
+			assert.Equal(t, &expected, version)
+		}
+	}
+	for _, src := range []string{"", "19.x", "1.2.3.4.5", "-1"} {
+		_, err := ParseVersion(src)
+		assert.Error(t, err, src)
+	}
+	if version, err := ParseVersion("19.14.3.3-stable"); assert.NoError(t, err) {
+		assert.Equal(t, "19.14.3", version.String())
+		assert.True(t, (&Version{19, 14, 3}).Equal(version))
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	assets := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{">=19.3, <20", "19.3.1.1", true},
+		{">=19.3, <20", "19.17.4.11", true},
+		{">=19.3, <20", "20.1.2.4", false},
+		{">=19.3, <20", "19.1.6", false},
+		{"~19.14", "19.14.3.3", true},
+		{"~19.14", "19.15.2.2", false},
+		{"~19.14", "19.13.7.57", false},
+		{"~19.14.3", "19.14.6.12", true},
+		{"~19.14.3", "19.14.2.2", false},
+		{"~19", "19.17.4.11", true},
+		{"~19", "20.1.2.4", false},
+		{"19.14", "19.14.7.15", true},
+		{"=19.14", "19.15.1.1", false},
+		{"!=19.14", "19.15.1.1", true},
+		{"<=19.3", "19.3.5", true},
+		{">19.3", "19.3.5", false},
+		{">19.3", "19.4.0", true},
+		{"<19 || >=20.3", "20.3.1", true},
+		{"<19 || >=20.3", "19.5.1", false},
+		{">= 21.8.10", "21.8.10.19-lts", true},
+	}
+	for _, asset := range assets {
+		constraint, err := ParseVersionConstraint(asset.constraint)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		version, err := ParseVersion(asset.version)
+		if assert.NoError(t, err) {
+			assert.Equal(t, asset.expected, constraint.Check(version), "%s %s", asset.version, asset.constraint)
+		}
+	}
+	for _, src := range []string{"", ">=", ">=19.3,", ">=a.b", "=>19", ">=19.14.3.3"} {
+		_, err := ParseVersionConstraint(src)
+		assert.Error(t, err, src)
+	}
+}
+
+func TestRequireVersion(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.RequireVersion(">=1")
+	if version, err := clickhouse.Version(); assert.NoError(t, err) {
+		cached, _ := clickhouse.Version()
+		assert.True(t, version == cached)
+	}
+	t.Run("skip", func(t *testing.T) {
+		Connect(t, "tcp://127.0.0.1:9000?debug=0").RequireVersion("<1")
+		t.Error("the test was not skipped")
+	})
+}
@@ -0,0 +1,184 @@
+package ok
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	pollInterval       = 100 * time.Millisecond
+)
+
+var errTimeout = errors.New("timeout")
+
+func (c *clickhouse) SetWaitTimeout(timeout time.Duration) {
+	c.waitTimeout = timeout
+}
+
+// WaitMutations waits until all mutations of the table are done.
+func (c *clickhouse) WaitMutations(database, table string) bool {
+	var pending []string
+	err := c.poll(c.timeout(), func() (bool, error) {
+		const query = `
+			SELECT
+				command
+				, latest_fail_reason
+			FROM system.mutations
+			WHERE database = ? AND table = ? AND is_done = 0
+		`
+		rows, err := c.conn.Query(query, database, table)
+		if err != nil {
+			return false, err
+		}
+		defer rows.Close()
+		for pending = pending[:0]; rows.Next(); {
+			var command, reason string
+			if err := rows.Scan(&command, &reason); err != nil {
+				return false, err
+			}
+			if len(reason) != 0 {
+				return false, fmt.Errorf("mutation '%s' failed: %s", command, reason)
+			}
+			pending = append(pending, command)
+		}
+		return len(pending) == 0, rows.Err()
+	})
+	switch {
+	case err == errTimeout:
+		c.test.Errorf("timeout while waiting for mutations of '%s.%s': %s", database, table, strings.Join(pending, "; "))
+		return false
+	case err != nil:
+		c.test.Errorf("an error occurred while waiting for mutations of '%s.%s': %v", database, table, err)
+		return false
+	}
+	return true
+}
+
+// OptimizeFinal merges all parts of the table and waits until no merges are left running.
+func (c *clickhouse) OptimizeFinal(database, table string) bool {
+	switch err := c.optimizeFinal(database, table); {
+	case err == errTimeout:
+		c.test.Errorf("timeout while waiting for merges of '%s.%s'", database, table)
+		return false
+	case err != nil:
+		c.test.Errorf("an error occurred while optimizing '%s.%s': %v", database, table, err)
+		return false
+	}
+	return true
+}
+
+func (c *clickhouse) optimizeFinal(database, table string) error {
+	if _, err := c.conn.Exec("OPTIMIZE TABLE " + database + "." + table + " FINAL"); err != nil {
+		return err
+	}
+	return c.poll(c.timeout(), func() (bool, error) {
+		return c.notExists("SELECT COUNT() FROM system.merges WHERE database = ? AND table = ?", database, table)
+	})
+}
+
+// FlushBuffer flushes the Buffer table into its destination table.
+func (c *clickhouse) FlushBuffer(database, table string) bool {
+	if _, err := c.conn.Exec("OPTIMIZE TABLE " + database + "." + table); err != nil {
+		c.test.Errorf("an error occurred while flushing the buffer: %v", err)
+		return false
+	}
+	return true
+}
+
+// WaitDictionaryLoaded waits until the dictionary status is LOADED and reports
+// the last exception of the dictionary when loading fails.
+func (c *clickhouse) WaitDictionaryLoaded(dictionary string) bool {
+	var status string
+	err := c.poll(c.timeout(), func() (bool, error) {
+		var lastException string
+		if err := c.conn.QueryRow(dictionaryStatusQuery(dictionary)).Scan(&status, &lastException); err != nil {
+			return false, err
+		}
+		switch status {
+		case "LOADED":
+			return true, nil
+		case "FAILED", "FAILED_AND_RELOADING":
+			return false, fmt.Errorf("dictionary '%s' failed to load: %s", dictionary, lastException)
+		}
+		return false, nil
+	})
+	switch {
+	case err == errTimeout:
+		c.test.Errorf("timeout while waiting for dictionary '%s' to load, status: %s", dictionary, status)
+		return false
+	case err != nil:
+		c.test.Error(err)
+		return false
+	}
+	return true
+}
+
+// Eventually polls the single value query until it returns the expected value, NULL for a nil expected value.
+func (c *clickhouse) Eventually(query string, expected interface{}, timeout time.Duration) bool {
+	var (
+		lastErr error
+		actual  = newScanTarget(expected)
+	)
+	err := c.poll(timeout, func() (bool, error) {
+		if lastErr = c.conn.QueryRow(query).Scan(actual.Interface()); lastErr != nil {
+			return false, nil
+		}
+		return reflect.DeepEqual(expected, actual.Elem().Interface()), nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			c.test.Errorf("query did not return %v within %s: %v", expected, timeout, lastErr)
+		} else {
+			c.test.Errorf("query did not return %v within %s, last value: %v", expected, timeout, actual.Elem().Interface())
+		}
+		return false
+	}
+	return true
+}
+
+// poll calls fn until it reports done, returns an error or the timeout expires.
+func (c *clickhouse) poll(timeout time.Duration, fn func() (bool, error)) error {
+	for deadline := time.Now().Add(timeout); ; time.Sleep(pollInterval) {
+		done, err := fn()
+		switch {
+		case err != nil:
+			return err
+		case done:
+			return nil
+		case time.Now().After(deadline):
+			return errTimeout
+		}
+	}
+}
+
+func (c *clickhouse) timeout() time.Duration {
+	if c.waitTimeout != 0 {
+		return c.waitTimeout
+	}
+	return defaultWaitTimeout
+}
+
+func (c *clickhouse) notExists(query string, args ...interface{}) (bool, error) {
+	var count int
+	if err := c.conn.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func dictionaryStatusQuery(dictionary string) string {
+	return "SELECT toString(status), last_exception FROM system.dictionaries WHERE " + dictionaryWhere(dictionary)
+}
+
+// newScanTarget returns a pointer to scan a value of the type of the expected value into,
+// a pointer to an empty interface for nil, which scans NULL as nil.
+func newScanTarget(expected interface{}) reflect.Value {
+	if expected == nil {
+		return reflect.New(reflect.TypeOf((*interface{})(nil)).Elem())
+	}
+	return reflect.New(reflect.TypeOf(expected))
+}
@@ -0,0 +1,54 @@
+package ok
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictionaryStatusQuery(t *testing.T) {
+	assert.Equal(t,
+		"SELECT toString(status), last_exception FROM system.dictionaries WHERE ((database = '' AND name = 'dictionary') OR (database = currentDatabase() AND name = 'dictionary'))",
+		dictionaryStatusQuery("dictionary"),
+	)
+	assert.Equal(t,
+		"SELECT toString(status), last_exception FROM system.dictionaries WHERE ((database = '' AND name = 'db.dictionary') OR (database = 'db' AND name = 'dictionary'))",
+		dictionaryStatusQuery("db.dictionary"),
+	)
+}
+
+func TestWait(t *testing.T) {
+	clickhouse := Connect(t, "tcp://127.0.0.1:9000?debug=0")
+	clickhouse.SetWaitTimeout(10 * time.Second)
+	defer clickhouse.Clear()
+	const ddl = `
+	CREATE DATABASE wait_tester;
+	CREATE TABLE wait_tester.events (
+		user_id  UInt64
+		, value  UInt64
+	) Engine SummingMergeTree ORDER BY user_id;
+	CREATE TABLE wait_tester.events_buffer AS wait_tester.events
+	Engine Buffer(wait_tester, events, 1, 3600, 3600, 1000000, 1000000, 100000000, 100000000);
+	`
+	if err := clickhouse.Exec(ddl); !assert.NoError(t, err) {
+		return
+	}
+	if assert.NoError(t, clickhouse.Exec("INSERT INTO wait_tester.events_buffer SELECT 1, number FROM system.numbers LIMIT 10")) {
+		assert.True(t, clickhouse.Eventually("SELECT COUNT() FROM wait_tester.events", uint64(0), time.Second))
+		assert.True(t, clickhouse.Eventually("SELECT CAST(NULL AS Nullable(UInt8))", nil, time.Second))
+		if assert.True(t, clickhouse.FlushBuffer("wait_tester", "events_buffer")) {
+			assert.True(t, clickhouse.Eventually("SELECT COUNT() FROM wait_tester.events", uint64(10), time.Second))
+		}
+	}
+	if assert.NoError(t, clickhouse.Exec("INSERT INTO wait_tester.events SELECT 1, number FROM system.numbers LIMIT 10")) {
+		if assert.True(t, clickhouse.OptimizeFinal("wait_tester", "events")) {
+			assert.True(t, clickhouse.Eventually("SELECT COUNT() FROM wait_tester.events", uint64(1), time.Second))
+		}
+	}
+	if assert.NoError(t, clickhouse.Exec("ALTER TABLE wait_tester.events DELETE WHERE user_id = 1")) {
+		if assert.True(t, clickhouse.WaitMutations("wait_tester", "events")) {
+			assert.True(t, clickhouse.Eventually("SELECT COUNT() FROM wait_tester.events", uint64(0), time.Second))
+		}
+	}
+}